@@ -1,26 +1,90 @@
 package archive
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/draganm/blobmap"
+	"github.com/draganm/linear/keyindex"
 	"github.com/draganm/statemate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (a *Archive) Append(ctx context.Context, sm *statemate.StateMate[uint64]) error {
+// Append archives the entries of the statemate as a new blob, which is readable once Append returns.
+func (a *Archive) Append(ctx context.Context, sm *statemate.StateMate[uint64]) (err error) {
+	if sm.IsEmpty() {
+		return errors.New("nothing to archive")
+	}
 
 	firstIndex := sm.GetFirstIndex()
 	lastIndex := sm.GetLastIndex()
 
+	ctx, span := tracer.Start(ctx, "archive.Append", trace.WithAttributes(
+		attribute.Int64("linear.from", int64(firstIndex)),
+		attribute.Int64("linear.to", int64(lastIndex)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	a.appendLock.Lock()
+	defer a.appendLock.Unlock()
+
+	// blobmaps hold keys in [first, first+count), which cannot include the last index of the space
+	if lastIndex == math.MaxUint64 {
+		return fmt.Errorf("index %d cannot be archived", lastIndex)
+	}
+
 	blobFileName := fmt.Sprintf("blob-%020d-%020d", firstIndex, lastIndex)
 
 	blobFilePath := filepath.Join(a.workDir, blobFileName)
+	defer os.Remove(blobFilePath)
+
+	keys, err := a.buildBlob(ctx, sm, blobFilePath)
+	if err != nil {
+		return err
+	}
+
+	key := path.Join(a.name, "blobs", blobFileName)
+
+	size, err := a.uploadBlob(ctx, key, blobFilePath, keys)
+	if err != nil {
+		return err
+	}
+
+	blob := archivedBlobMap{
+		from:         firstIndex,
+		to:           lastIndex,
+		key:          key,
+		size:         size,
+		lastModified: time.Now(),
+	}
+	blob.created = blob.lastModified
+
+	if a.keyExtractor != nil {
+		blob.keyIndexKey = key + keyIndexSuffix
+	}
+
+	a.readLock.Lock()
+	a.insertBlobMap(blob)
+	a.readLock.Unlock()
+
+	return nil
+}
+
+// buildBlob writes the entries of the statemate into a blobmap file and returns their key index.
+func (a *Archive) buildBlob(ctx context.Context, sm *statemate.StateMate[uint64], blobFilePath string) (keys keyindex.Index, err error) {
+	_, span := tracer.Start(ctx, "archive.buildBlob")
+	defer func() { endSpan(span, err) }()
+
+	firstIndex := sm.GetFirstIndex()
+	lastIndex := sm.GetLastIndex()
 
 	builder, err := blobmap.NewBuilder(
 		blobFilePath,
@@ -28,43 +92,69 @@ func (a *Archive) Append(ctx context.Context, sm *statemate.StateMate[uint64]) e
 		lastIndex-firstIndex+1,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create blob builder: %w", err)
+		return nil, fmt.Errorf("failed to create blob builder: %w", err)
 	}
 
+	keys = keyindex.Index{}
+
 	for i := firstIndex; i <= lastIndex; i++ {
 		err = sm.Read(i, func(data []byte) error {
+			if a.keyExtractor != nil {
+				k, ok := a.keyExtractor(data)
+				if ok {
+					keys.Add(k, i)
+				}
+			}
 			return builder.Add(i, data)
 		})
 		if err != nil {
-			return fmt.Errorf("failed to add data to blob: %w", err)
+			return nil, fmt.Errorf("failed to add data to blob: %w", err)
 		}
 	}
 
 	err = builder.Build()
 	if err != nil {
-		return fmt.Errorf("failed to build blob: %w", err)
+		return nil, fmt.Errorf("failed to build blob: %w", err)
 	}
 
-	uploader := manager.NewUploader(
-		a.s3Client,
-	)
+	return keys, nil
+}
 
-	key := path.Join(a.name, "blobs", blobFileName)
+// uploadBlob uploads the key index, if the archive extracts keys, and the blob file. It returns the size of the blob.
+func (a *Archive) uploadBlob(ctx context.Context, key, blobFilePath string, keys keyindex.Index) (size uint64, err error) {
+	ctx, span := tracer.Start(ctx, "archive.uploadBlob", trace.WithAttributes(attribute.String("linear.key", key)))
+	defer func() { endSpan(span, err) }()
+
+	// the key index is uploaded before the blob, an orphaned key index is ignored by Open
+	if a.keyExtractor != nil {
+		d, err := keys.Marshal()
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal key index: %w", err)
+		}
+
+		err = a.store.Put(ctx, key+keyIndexSuffix, bytes.NewReader(d))
+		if err != nil {
+			return 0, fmt.Errorf("failed to upload key index: %w", err)
+		}
+	}
 
 	f, err := os.Open(blobFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open blob file: %w", err)
+		return 0, fmt.Errorf("failed to open blob file: %w", err)
 	}
 	defer f.Close()
 
-	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: &a.s3Bucket,
-		Key:    &key,
-		Body:   f,
-	})
+	fi, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to upload blob to s3: %w", err)
+		return 0, fmt.Errorf("failed to stat blob file: %w", err)
 	}
 
-	return nil
+	span.SetAttributes(attribute.Int64("linear.size", fi.Size()))
+
+	err = a.store.Put(ctx, key, f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload blob: %w", err)
+	}
+
+	return uint64(fi.Size()), nil
 }
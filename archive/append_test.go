@@ -10,6 +10,7 @@ import (
 	"github.com/draganm/linear/archive"
 	"github.com/draganm/linear/blobmapcache"
 	"github.com/draganm/linear/e2eutils"
+	"github.com/draganm/linear/objectstore"
 	"github.com/draganm/statemate"
 	"github.com/neilotoole/slogt"
 	"github.com/stretchr/testify/require"
@@ -39,8 +40,7 @@ func TestAppend(t *testing.T) {
 			ctx,
 			log,
 			archive.OpenOptions{
-				S3Client:     s3Client,
-				S3Bucket:     bucketName,
+				Store:        objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
 				Name:         "test-archive",
 				BlobmapCache: bmc,
 				WorkDir:      workDir,
@@ -93,8 +93,7 @@ func TestAppend(t *testing.T) {
 			ctx,
 			log,
 			archive.OpenOptions{
-				S3Client:     s3Client,
-				S3Bucket:     bucketName,
+				Store:        objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
 				Name:         "test-archive",
 				BlobmapCache: bmc,
 				WorkDir:      workDir,
@@ -1,39 +1,97 @@
 package archive
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"path"
 	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/keyindex"
+	"github.com/draganm/linear/lru"
+	"github.com/draganm/linear/objectstore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/draganm/linear/archive")
+
+// endSpan ends a span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 type OpenOptions struct {
-	S3Client     *s3.Client
-	S3Bucket     string
-	Name         string
+	Store objectstore.Store
+	Name  string
+	// BlobmapCache is not used, and can be nil, if the store keeps objects in local files.
 	BlobmapCache *blobmapcache.BlobmapCache
 	WorkDir      string
+	KeyExtractor keyindex.Extractor
+	// KeyIndexCacheSize limits the memory used by loaded key indexes, defaults to DefaultKeyIndexCacheSize.
+	KeyIndexCacheSize uint64
+	// ReadAhead is the number of upcoming blobmaps fetched into the cache while a read consumes the current one.
+	ReadAhead int
+	// RangedReadThreshold enables ranged reads of blobmaps that are not cached: reads estimated to
+	// fetch fewer bytes than the threshold get only the requested entries instead of the whole blobmap.
+	// Zero disables ranged reads.
+	RangedReadThreshold uint64
+	// Tiers are the stores blobs can be moved to by ApplyTiering. They must not share keys with Store.
+	Tiers map[string]objectstore.Store
+	// RefreshInterval enables periodic refreshing of the archived blobs, picking up blobs
+	// appended by other processes. Zero disables it, Refresh can still be called explicitly.
+	RefreshInterval time.Duration
 }
 
+const DefaultKeyIndexCacheSize = 64 * 1024 * 1024
+
+const keyIndexSuffix = ".keys"
+
 var blobRegexp = regexp.MustCompile(`^blob-(\d{20})-(\d{20})$`)
 
 type Archive struct {
-	s3Client         *s3.Client
-	s3Bucket         string
+	log          *slog.Logger
+	store        objectstore.Store
+	tiers        map[string]objectstore.Store
+	tierManifest tierManifest
+	// staleKeys are objects superseded by a tier move or a compaction but not deleted
+	staleKeys        []staleKey
 	name             string
 	workDir          string
 	blobMapsCache    *blobmapcache.BlobmapCache
 	archivedBlobMaps []archivedBlobMap
+	archivedBytes    uint64
+	keyExtractor     keyindex.Extractor
+	keyIndexCache    *lru.Cache[keyindex.Index]
+	readAhead        int
+	rangedThreshold  uint64
 	appendLock       sync.Mutex
 	readLock         sync.RWMutex
+	// maintenanceLock serializes tier moves, compactions and refreshes
+	maintenanceLock sync.Mutex
+	stopRefresh     context.CancelFunc
+	refreshDone     chan struct{}
+	// closed is canceled by Close, stopping prefetches of reads still running
+	closed      context.Context
+	cancelClose context.CancelFunc
+	// epoch counts the reads that may use blobs about to be replaced, stale keys are deleted once
+	// their reads are done
+	epochLock sync.Mutex
+	epoch     *readEpoch
 }
 
 type archivedBlobMap struct {
@@ -41,6 +99,15 @@ type archivedBlobMap struct {
 	to   uint64
 	key  string
 	size uint64
+	// tier is the name of the tier store holding the blob, empty for the archive store
+	tier         string
+	lastModified time.Time
+	// keyIndexKey is the key of the key index sidecar, empty if the blob has none
+	keyIndexKey string
+	// created is the age of the blob for tiering rules, which is the age of the oldest source for
+	// compacted blobs. Unlike lastModified, which breaks ties between overlapping blobs, it is kept
+	// when a blob is moved to a tier and only restoring a blob from its tier makes it new again.
+	created time.Time
 }
 
 func Open(
@@ -48,73 +115,263 @@ func Open(
 	log *slog.Logger,
 	opts OpenOptions,
 ) (*Archive, error) {
-	cl := opts.S3Client
+	if opts.BlobmapCache == nil {
+		for _, st := range append([]objectstore.Store{opts.Store}, slices.Collect(maps.Values(opts.Tiers))...) {
+			_, local := st.(objectstore.LocalFiles)
+			if !local {
+				return nil, errors.New("blobmap cache is required for stores without local files")
+			}
+		}
+	}
+
+	blobMaps, manifest, staleKeys, err := listBlobMaps(ctx, log, opts.Store, opts.Name, opts.Tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	keyIndexCacheSize := opts.KeyIndexCacheSize
+	if keyIndexCacheSize == 0 {
+		keyIndexCacheSize = DefaultKeyIndexCacheSize
+	}
+
+	a := &Archive{
+		log:              log,
+		store:            opts.Store,
+		tiers:            opts.Tiers,
+		tierManifest:     manifest,
+		staleKeys:        staleKeys,
+		name:             opts.Name,
+		workDir:          opts.WorkDir,
+		blobMapsCache:    opts.BlobmapCache,
+		archivedBlobMaps: blobMaps,
+		archivedBytes:    totalSize(blobMaps),
+		keyExtractor:     opts.KeyExtractor,
+		keyIndexCache:    lru.NewCache[keyindex.Index](keyIndexCacheSize, nil),
+		readAhead:        opts.ReadAhead,
+		rangedThreshold:  opts.RangedReadThreshold,
+		epoch:            &readEpoch{},
+	}
+
+	a.closed, a.cancelClose = context.WithCancel(context.Background())
+
+	if opts.RefreshInterval > 0 {
+		a.startRefresh(opts.RefreshInterval)
+	}
+
+	return a, nil
+}
 
+// listBlobMaps lists the blobs of the archive in the archive store and the tier stores, sorted by index.
+// Blobs superseded by a tier move or a compaction are returned as stale keys.
+func listBlobMaps(
+	ctx context.Context,
+	log *slog.Logger,
+	store objectstore.Store,
+	name string,
+	tiers map[string]objectstore.Store,
+) ([]archivedBlobMap, tierManifest, []staleKey, error) {
 	blobMaps := []archivedBlobMap{}
-	var continuationToken *string
+	keyIndexes := map[string]bool{}
+	staleKeys := []staleKey{}
 
-	prefix := path.Join(opts.Name, "blobs")
+	prefix := path.Join(name, "blobs")
 
-	for {
+	// the blobs are listed before the manifest is loaded, a blob being moved concurrently is then
+	// either listed or already in the manifest
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		res, err := cl.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
-			Bucket:            &opts.S3Bucket,
-			Prefix:            aws.String(prefix),
-			ContinuationToken: continuationToken,
-		})
+	manifest, err := loadTierManifest(ctx, store, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
+	for _, o := range objects {
+		name := path.Base(o.Key)
+
+		if strings.HasSuffix(name, keyIndexSuffix) {
+			keyIndexes[o.Key] = true
+			continue
+		}
+
+		log.Debug("blob", "key", o.Key, "size", o.Size, "name", name)
+
+		m := blobRegexp.FindStringSubmatch(name)
+
+		if m == nil {
+			continue
+		}
+
+		from, err := strconv.ParseUint(m[1], 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, fmt.Errorf("failed to parse blob from index %q: %w", m[1], err)
 		}
 
-		for _, key := range res.Contents {
-			name := path.Base(*key.Key)
+		to, err := strconv.ParseUint(m[2], 10, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse blob to index %q: %w", m[2], err)
+		}
 
-			log.Info("blob", "key", *key.Key, "size", *key.Size, "name", name)
+		if manifest[o.Key].Tier != "" {
+			// left over from a move that did not finish deleting the source, the manifest is authoritative
+			staleKeys = append(staleKeys, staleKey{key: o.Key})
+			continue
+		}
 
-			m := blobRegexp.FindStringSubmatch(name)
+		created := o.LastModified
+		if c := manifest[o.Key].Created; !c.IsZero() {
+			created = c
+		}
 
-			if m == nil {
-				continue
-			}
+		blobMaps = append(blobMaps, archivedBlobMap{
+			from:         from,
+			to:           to,
+			key:          o.Key,
+			size:         o.Size,
+			lastModified: o.LastModified,
+			created:      created,
+		})
 
-			from, err := strconv.ParseUint(m[1], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse blob from index %q: %w", m[1], err)
-			}
+	}
 
-			to, err := strconv.ParseUint(m[2], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse blob to index %q: %w", m[2], err)
-			}
+	tiered, err := manifest.blobMaps(tiers)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-			blobMaps = append(blobMaps, archivedBlobMap{
-				from: from,
-				to:   to,
-				key:  *key.Key,
-				size: uint64(*key.Size),
-			})
+	blobMaps = append(blobMaps, tiered...)
 
+	for i, bm := range blobMaps {
+		if keyIndexes[bm.key+keyIndexSuffix] {
+			blobMaps[i].keyIndexKey = bm.key + keyIndexSuffix
 		}
+	}
 
-		continuationToken = res.NextContinuationToken
+	slices.SortFunc(blobMaps, func(a, b archivedBlobMap) int {
+		return cmp.Or(cmp.Compare(a.from, b.from), cmp.Compare(b.to, a.to))
+	})
 
-		if continuationToken == nil {
-			break
+	// a compaction that did not finish deleting its sources leaves blobs covered by the merged one
+	kept := []archivedBlobMap{}
+	for _, bm := range blobMaps {
+		if len(kept) > 0 && bm.to <= kept[len(kept)-1].to {
+			if bm.tier == "" {
+				staleKeys = append(staleKeys, staleKey{key: bm.key})
+				if bm.keyIndexKey != "" {
+					staleKeys = append(staleKeys, staleKey{key: bm.keyIndexKey})
+				}
+			}
+			continue
 		}
+		kept = append(kept, bm)
+	}
+
+	return kept, manifest, staleKeys, nil
+}
 
+// insertBlobMap adds a blob to the archived blobs, replacing the blobs it covers.
+// A blob covered by an archived blob is not added, so that no archived blob contains another.
+// The caller must hold the write lock of readLock.
+func (a *Archive) insertBlobMap(blob archivedBlobMap) {
+	for _, bm := range a.archivedBlobMaps {
+		if bm.from <= blob.from && blob.to <= bm.to && bm.key != blob.key {
+			return
+		}
 	}
 
-	slices.SortFunc(blobMaps, func(a, b archivedBlobMap) int {
-		return int(a.from) - int(b.from)
+	a.archivedBlobMaps = slices.DeleteFunc(a.archivedBlobMaps, func(bm archivedBlobMap) bool {
+		covered := bm.from >= blob.from && bm.to <= blob.to
+		if covered {
+			a.archivedBytes -= bm.size
+		}
+		return covered
+	})
+	i, _ := slices.BinarySearchFunc(a.archivedBlobMaps, blob.from, func(bm archivedBlobMap, from uint64) int {
+		return cmp.Compare(bm.from, from)
 	})
+	a.archivedBlobMaps = slices.Insert(a.archivedBlobMaps, i, blob)
+	a.archivedBytes += blob.size
+}
 
-	return &Archive{
-		s3Client:         opts.S3Client,
-		s3Bucket:         opts.S3Bucket,
-		name:             opts.Name,
-		workDir:          opts.WorkDir,
-		blobMapsCache:    opts.BlobmapCache,
-		archivedBlobMaps: blobMaps,
-	}, nil
+func totalSize(blobMaps []archivedBlobMap) uint64 {
+	total := uint64(0)
+	for _, bm := range blobMaps {
+		total += bm.size
+	}
+	return total
+}
+
+// ArchivedBytes returns the total size of the archived blobs in the archive store and the tiers.
+func (a *Archive) ArchivedBytes() uint64 {
+	a.readLock.RLock()
+	defer a.readLock.RUnlock()
+
+	return a.archivedBytes
+}
+
+// Bounds returns the first and the last archived index, ok is false if the archive is empty.
+func (a *Archive) Bounds() (first, last uint64, ok bool) {
+	a.readLock.RLock()
+	defer a.readLock.RUnlock()
+
+	if len(a.archivedBlobMaps) == 0 {
+		return 0, 0, false
+	}
+
+	return a.archivedBlobMaps[0].from, a.archivedBlobMaps[len(a.archivedBlobMaps)-1].to, true
+}
+
+// staleKey is an object superseded by a tier move or a compaction in the store of the tier.
+type staleKey struct {
+	tier string
+	key  string
+}
+
+// deleteStaleKeys deletes objects superseded by tier moves or compactions once the reads that
+// may still use them are done.
+func (a *Archive) deleteStaleKeys(ctx context.Context) error {
+	a.readLock.Lock()
+	staleKeys := a.staleKeys
+	a.staleKeys = nil
+	a.readLock.Unlock()
+
+	if len(staleKeys) == 0 {
+		return nil
+	}
+
+	requeue := func(keys []staleKey) {
+		a.readLock.Lock()
+		a.staleKeys = append(a.staleKeys, keys...)
+		a.readLock.Unlock()
+	}
+
+	err := a.drainReads(ctx)
+	if err != nil {
+		requeue(staleKeys)
+		return fmt.Errorf("failed to wait for reads of superseded objects: %w", err)
+	}
+
+	for i, sk := range staleKeys {
+		err := a.storeFor(sk.tier).Delete(ctx, sk.key)
+		if err != nil {
+			requeue(staleKeys[i:])
+			return fmt.Errorf("failed to delete superseded object %s: %w", sk.key, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) storeFor(tier string) objectstore.Store {
+	if tier == "" {
+		return a.store
+	}
+	return a.tiers[tier]
+}
+
+// KeyIndexCacheSize returns the size of the loaded key indexes and its limit.
+func (a *Archive) KeyIndexCacheSize() (size, maxSize uint64) {
+	return a.keyIndexCache.Size(), a.keyIndexCache.MaxSize()
 }
@@ -0,0 +1,211 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/draganm/blobmap"
+	"github.com/draganm/linear/keyindex"
+)
+
+// Compact merges runs of adjacent blobs in the archive store that are smaller than targetSize
+// into blobs of at most targetSize. Merged blobs are published before the originals are deleted,
+// and Open ignores originals left behind by an interrupted compaction.
+func (a *Archive) Compact(ctx context.Context, targetSize uint64) error {
+	a.maintenanceLock.Lock()
+	defer a.maintenanceLock.Unlock()
+
+	err := a.deleteStaleKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.readLock.RLock()
+	blobMaps := slices.Clone(a.archivedBlobMaps)
+	a.readLock.RUnlock()
+
+	for _, run := range compactionRuns(blobMaps, targetSize) {
+		err = a.mergeBlobs(ctx, run)
+		if err != nil {
+			return fmt.Errorf("failed to merge blobs %d-%d: %w", run[0].from, run[len(run)-1].to, err)
+		}
+	}
+
+	return a.deleteStaleKeys(ctx)
+}
+
+// compactionRuns returns runs of at least two contiguous blobs in the archive store whose total size fits targetSize.
+func compactionRuns(blobMaps []archivedBlobMap, targetSize uint64) [][]archivedBlobMap {
+	runs := [][]archivedBlobMap{}
+
+	var run []archivedBlobMap
+	var size uint64
+
+	flush := func() {
+		if len(run) > 1 {
+			runs = append(runs, run)
+		}
+		run = nil
+		size = 0
+	}
+
+	for _, bm := range blobMaps {
+		if bm.tier != "" || bm.size >= targetSize {
+			flush()
+			continue
+		}
+
+		if len(run) > 0 && (bm.from != run[len(run)-1].to+1 || size+bm.size > targetSize) {
+			flush()
+		}
+
+		run = append(run, bm)
+		size += bm.size
+	}
+
+	flush()
+
+	return runs
+}
+
+func (a *Archive) mergeBlobs(ctx context.Context, run []archivedBlobMap) error {
+	from, to := run[0].from, run[len(run)-1].to
+
+	blobFileName := fmt.Sprintf("blob-%020d-%020d", from, to)
+	blobFilePath := filepath.Join(a.workDir, blobFileName)
+
+	builder, err := blobmap.NewBuilder(blobFilePath, from, to-from+1)
+	if err != nil {
+		return fmt.Errorf("failed to create blob builder: %w", err)
+	}
+	defer os.Remove(blobFilePath)
+
+	keys := keyindex.Index{}
+	withKeys := a.keyExtractor != nil
+
+	for _, bm := range run {
+		extractKeys := a.keyExtractor != nil
+
+		if bm.keyIndexKey != "" {
+			idx, err := a.loadKeyIndex(ctx, bm.keyIndexKey)
+			if err != nil {
+				return err
+			}
+			for k, indexes := range idx {
+				for _, i := range indexes {
+					keys.Add(k, i)
+				}
+			}
+			withKeys = true
+			extractKeys = false
+		}
+
+		step := readPlanStep{
+			from:       bm.from,
+			count:      bm.to - bm.from + 1,
+			blobmapKey: bm.key,
+			size:       bm.size,
+			blobFrom:   bm.from,
+			blobTo:     bm.to,
+			store:      a.store,
+		}
+
+		err = a.executeReadPlan(ctx, []readPlanStep{step}, func(ctx context.Context, index uint64, data []byte) error {
+			if extractKeys {
+				k, ok := a.keyExtractor(data)
+				if ok {
+					keys.Add(k, index)
+				}
+			}
+			return builder.Add(index, data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = builder.Build()
+	if err != nil {
+		return fmt.Errorf("failed to build blob: %w", err)
+	}
+
+	key := path.Join(a.name, "blobs", blobFileName)
+
+	// the merged blob is as old as its oldest source, so that compacting doesn't postpone tiering
+	merged := archivedBlobMap{
+		from:         from,
+		to:           to,
+		key:          key,
+		lastModified: time.Now(),
+		created:      run[0].created,
+	}
+	for _, bm := range run[1:] {
+		if bm.created.Before(merged.created) {
+			merged.created = bm.created
+		}
+	}
+
+	// the age is recorded before the merged blob is published, an age left behind by a failed
+	// compaction is only ever used by a later compaction of the same blobs
+	err = a.updateTierManifest(ctx, func(m tierManifest) tierManifest {
+		m = maps.Clone(m)
+		for _, bm := range run {
+			delete(m, bm.key)
+		}
+		m[key] = tierEntry{Created: merged.created}
+		return m
+	})
+	if err != nil {
+		return err
+	}
+
+	if withKeys {
+		d, err := keys.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal key index: %w", err)
+		}
+
+		err = a.store.Put(ctx, key+keyIndexSuffix, bytes.NewReader(d))
+		if err != nil {
+			return fmt.Errorf("failed to upload key index: %w", err)
+		}
+		merged.keyIndexKey = key + keyIndexSuffix
+	}
+
+	f, err := os.Open(blobFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open blob file: %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat blob file: %w", err)
+	}
+	merged.size = uint64(fi.Size())
+
+	err = a.store.Put(ctx, key, f)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+
+	// the sources are deleted once the reads planned against them are done
+	a.readLock.Lock()
+	a.insertBlobMap(merged)
+	for _, bm := range run {
+		a.staleKeys = append(a.staleKeys, staleKey{key: bm.key})
+		if bm.keyIndexKey != "" {
+			a.staleKeys = append(a.staleKeys, staleKey{key: bm.keyIndexKey})
+		}
+	}
+	a.readLock.Unlock()
+
+	return nil
+}
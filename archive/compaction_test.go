@@ -0,0 +1,206 @@
+package archive_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/keyindex"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+
+	store := objectstore.NewMemory()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	opts := archive.OpenOptions{
+		Store:        store,
+		Name:         "test-archive",
+		BlobmapCache: bmc,
+		WorkDir:      t.TempDir(),
+		KeyExtractor: keyindex.ByteRangeExtractor(0, 1),
+	}
+
+	log := slogt.New(t)
+	ar, err := archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	for from := uint64(0); from < 100; from += 10 {
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+
+		for i := from; i < from+10; i++ {
+			require.NoError(t, sm.Append(i, []byte{byte(i)}))
+		}
+
+		require.NoError(t, ar.Append(ctx, sm))
+		require.NoError(t, sm.Close())
+	}
+
+	objectKeys := func() []string {
+		infos, err := store.List(ctx, "test-archive/blobs/")
+		require.NoError(t, err)
+		keys := []string{}
+		for _, o := range infos {
+			keys = append(keys, o.Key)
+		}
+		return keys
+	}
+
+	require.Len(t, objectKeys(), 20)
+
+	original := "test-archive/blobs/blob-00000000000000000010-00000000000000000019"
+	r, err := store.Get(ctx, original)
+	require.NoError(t, err)
+	originalData, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	ar, err = archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	oldest := ar.Blobs()[0].Created
+	size := uint64(0)
+	for _, b := range ar.Blobs() {
+		if b.Created.Before(oldest) {
+			oldest = b.Created
+		}
+		size += b.Size
+	}
+	require.Equal(t, size, ar.ArchivedBytes())
+
+	require.NoError(t, ar.Compact(ctx, 1024*1024))
+	require.Len(t, ar.Blobs(), 1)
+	require.True(t, oldest.Equal(ar.Blobs()[0].Created))
+	require.True(t, ar.Blobs()[0].LastModified.After(oldest))
+	require.Equal(t, ar.Blobs()[0].Size, ar.ArchivedBytes())
+	require.Equal(t, []string{
+		"test-archive/blobs/blob-00000000000000000000-00000000000000000099",
+		"test-archive/blobs/blob-00000000000000000000-00000000000000000099.keys",
+	}, objectKeys())
+
+	check := func(ar *archive.Archive) {
+		indexes := []uint64{}
+		err := ar.Read(ctx, 0, 100, func(ctx context.Context, index uint64, data []byte) error {
+			require.Equal(t, []byte{byte(index)}, data)
+			indexes = append(indexes, index)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, indexes, 100)
+
+		found, err := ar.LookupKey(ctx, "2a")
+		require.NoError(t, err)
+		require.Equal(t, []uint64{42}, found)
+	}
+
+	check(ar)
+
+	t.Run("keeps the age of the sources across reopening", func(t *testing.T) {
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+		require.Len(t, ar.Blobs(), 1)
+		require.True(t, oldest.Equal(ar.Blobs()[0].Created))
+	})
+
+	t.Run("interrupted compaction", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, original, strings.NewReader(string(originalData))))
+
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+		check(ar)
+
+		require.NoError(t, ar.Compact(ctx, 1024*1024))
+		require.Len(t, objectKeys(), 2)
+	})
+}
+
+func TestCompactWaitsForReads(t *testing.T) {
+	ctx := context.Background()
+
+	store := objectstore.NewMemory()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	ar, err := archive.Open(ctx, slogt.New(t), archive.OpenOptions{
+		Store:        store,
+		Name:         "test-archive",
+		BlobmapCache: bmc,
+		WorkDir:      t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	for from := uint64(0); from < 30; from += 10 {
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+		for i := from; i < from+10; i++ {
+			require.NoError(t, sm.Append(i, []byte{byte(i)}))
+		}
+		require.NoError(t, ar.Append(ctx, sm))
+		require.NoError(t, sm.Close())
+	}
+
+	// a fresh cache, so that the read has to download the blobs compacted under it
+	bmc, err = blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	ar, err = archive.Open(ctx, slogt.New(t), archive.OpenOptions{
+		Store:        store,
+		Name:         "test-archive",
+		BlobmapCache: bmc,
+		WorkDir:      t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	reading := make(chan struct{})
+	release := make(chan struct{})
+	read := make(chan error, 1)
+
+	go func() {
+		read <- ar.Read(ctx, 0, 30, func(ctx context.Context, index uint64, data []byte) error {
+			if index == 0 {
+				close(reading)
+				<-release
+			}
+			return nil
+		})
+	}()
+
+	<-reading
+
+	compacted := make(chan error, 1)
+	go func() {
+		compacted <- ar.Compact(ctx, 1024*1024)
+	}()
+
+	select {
+	case err := <-compacted:
+		close(release)
+		t.Fatalf("compaction deleted the blobs of a read in progress: %v, read: %v", err, <-read)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-read)
+	require.NoError(t, <-compacted)
+
+	infos, err := store.List(ctx, "test-archive/blobs/")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+}
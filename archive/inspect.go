@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// BlobInfo describes an archived blob.
+type BlobInfo struct {
+	From uint64
+	To   uint64
+	Key  string
+	Size uint64
+	// Tier is the name of the tier store holding the blob, empty for the archive store.
+	Tier         string
+	LastModified time.Time
+	// Created is the age of the blob for tiering rules, which is the age of the oldest source
+	// for compacted blobs.
+	Created time.Time
+	// KeyIndexKey is the key of the key index sidecar, empty if the blob has none.
+	KeyIndexKey string
+}
+
+// Blobs returns the archived blobs in index order.
+func (a *Archive) Blobs() []BlobInfo {
+	a.readLock.RLock()
+	defer a.readLock.RUnlock()
+
+	blobs := make([]BlobInfo, len(a.archivedBlobMaps))
+	for i, bm := range a.archivedBlobMaps {
+		blobs[i] = BlobInfo{
+			From:         bm.from,
+			To:           bm.to,
+			Key:          bm.key,
+			Size:         bm.size,
+			Tier:         bm.tier,
+			LastModified: bm.lastModified,
+			Created:      bm.created,
+			KeyIndexKey:  bm.keyIndexKey,
+		}
+	}
+
+	return blobs
+}
+
+// VerifyBlob downloads an archived blob and checks its header against the indexes in its key,
+// the positions of its entries and its checksum. The key index sidecar, if any, must decode and
+// refer to indexes of the blob only.
+func (a *Archive) VerifyBlob(ctx context.Context, blob BlobInfo) error {
+	st := a.storeFor(blob.Tier)
+	if st == nil {
+		return fmt.Errorf("unknown tier %q", blob.Tier)
+	}
+
+	r, err := st.Get(ctx, blob.Key)
+	if err != nil {
+		return fmt.Errorf("failed to get blob: %w", err)
+	}
+	defer r.Close()
+
+	err = verifyBlobmap(bufio.NewReader(r), blob.From, blob.To)
+	if err != nil {
+		return err
+	}
+
+	if blob.KeyIndexKey == "" {
+		return nil
+	}
+
+	idx, err := a.loadKeyIndex(ctx, blob.KeyIndexKey)
+	if err != nil {
+		return err
+	}
+
+	for k, indexes := range idx {
+		for _, i := range indexes {
+			if i < blob.From || i > blob.To {
+				return fmt.Errorf("key index refers to index %d of key %q outside of the blob", i, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// verifyBlobmap checks a blobmap holding the keys in [from, to] read from r.
+func verifyBlobmap(r io.Reader, from, to uint64) error {
+	h := xxhash.New()
+	tr := io.TeeReader(r, h)
+
+	var header [16]byte
+	_, err := io.ReadFull(tr, header[:])
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	count := binary.BigEndian.Uint64(header[:8])
+	firstKey := binary.BigEndian.Uint64(header[8:])
+
+	if firstKey != from || count != to-from+1 {
+		return fmt.Errorf("header holds %d keys from %d, expected %d-%d", count, firstKey, from, to)
+	}
+
+	var end [8]byte
+	dataSize := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		_, err = io.ReadFull(tr, end[:])
+		if err != nil {
+			return fmt.Errorf("failed to read position of key %d: %w", from+i, err)
+		}
+
+		e := binary.BigEndian.Uint64(end[:])
+		if e < dataSize {
+			return fmt.Errorf("entry of key %d ends at %d before its start %d", from+i, e, dataSize)
+		}
+		dataSize = e
+	}
+
+	n, err := io.CopyN(io.Discard, tr, int64(dataSize))
+	if err != nil {
+		return fmt.Errorf("data is truncated after %d of %d bytes: %w", n, dataSize, err)
+	}
+
+	var checksum [8]byte
+	_, err = io.ReadFull(r, checksum[:])
+	if err != nil {
+		return fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	if binary.BigEndian.Uint64(checksum[:]) != h.Sum64() {
+		return errors.New("checksum mismatch")
+	}
+
+	n, err = io.Copy(io.Discard, r)
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%d unexpected bytes after the checksum", n)
+	}
+
+	return nil
+}
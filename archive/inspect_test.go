@@ -0,0 +1,87 @@
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/keyindex"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBlob(t *testing.T) {
+	ctx := context.Background()
+
+	store := objectstore.NewMemory()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	ar, err := archive.Open(ctx, slogt.New(t), archive.OpenOptions{
+		Store:        store,
+		Name:         "test-archive",
+		BlobmapCache: bmc,
+		WorkDir:      t.TempDir(),
+		KeyExtractor: keyindex.ByteRangeExtractor(0, 1),
+	})
+	require.NoError(t, err)
+	defer ar.Close()
+
+	for from := uint64(0); from < 20; from += 10 {
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+
+		for i := from; i < from+10; i++ {
+			require.NoError(t, sm.Append(i, []byte{byte(i), 1, 2, 3}))
+		}
+
+		require.NoError(t, ar.Append(ctx, sm))
+		require.NoError(t, sm.Close())
+	}
+
+	blobs := ar.Blobs()
+	require.Len(t, blobs, 2)
+	require.Equal(t, uint64(10), blobs[1].From)
+	require.Equal(t, uint64(19), blobs[1].To)
+	require.Equal(t, blobs[1].Key+".keys", blobs[1].KeyIndexKey)
+
+	for _, b := range blobs {
+		require.NoError(t, ar.VerifyBlob(ctx, b))
+	}
+
+	r, err := store.Get(ctx, blobs[1].Key)
+	require.NoError(t, err)
+	original, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	corrupt := func(t *testing.T, data []byte) error {
+		require.NoError(t, store.Put(ctx, blobs[1].Key, bytes.NewReader(data)))
+		t.Cleanup(func() {
+			require.NoError(t, store.Put(ctx, blobs[1].Key, bytes.NewReader(original)))
+		})
+		return ar.VerifyBlob(ctx, blobs[1])
+	}
+
+	t.Run("flipped data byte", func(t *testing.T) {
+		data := bytes.Clone(original)
+		data[len(data)-10] ^= 0xff
+		require.ErrorContains(t, corrupt(t, data), "checksum mismatch")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		require.ErrorContains(t, corrupt(t, original[:len(original)-12]), "truncated")
+	})
+
+	t.Run("wrong range", func(t *testing.T) {
+		require.ErrorContains(t, ar.VerifyBlob(ctx, archive.BlobInfo{From: 10, To: 20, Key: blobs[1].Key}), "expected 10-20")
+	})
+}
@@ -0,0 +1,83 @@
+package archive_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/keyindex"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFilesStore(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := objectstore.NewFilesystem(t.TempDir())
+	require.NoError(t, err)
+
+	opts := archive.OpenOptions{
+		Store:        store,
+		Name:         "test-archive",
+		WorkDir:      t.TempDir(),
+		KeyExtractor: keyindex.ByteRangeExtractor(0, 1),
+	}
+
+	log := slogt.New(t)
+	ar, err := archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	for _, r := range [][2]uint64{{0, 49}, {50, 99}} {
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+
+		for i := r[0]; i <= r[1]; i++ {
+			err = sm.Append(i, []byte{byte(i)})
+			require.NoError(t, err)
+		}
+
+		err = ar.Append(ctx, sm)
+		require.NoError(t, err)
+		require.NoError(t, sm.Close())
+	}
+
+	ar, err = archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	indexes := []uint64{}
+	err = ar.Read(ctx, 48, 4, func(ctx context.Context, index uint64, data []byte) error {
+		require.Equal(t, []byte{byte(index)}, data)
+		indexes = append(indexes, index)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{48, 49, 50, 51}, indexes)
+
+	indexes = []uint64{}
+	err = ar.ReadReverse(ctx, 51, 4, func(ctx context.Context, index uint64, data []byte) error {
+		indexes = append(indexes, index)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{51, 50, 49, 48}, indexes)
+
+	found, err := ar.LookupKey(ctx, "32")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{50}, found)
+}
+
+func TestOpenRequiresCacheForRemoteStores(t *testing.T) {
+	_, err := archive.Open(
+		context.Background(),
+		slogt.New(t),
+		archive.OpenOptions{
+			Store:   objectstore.NewMemory(),
+			Name:    "test-archive",
+			WorkDir: t.TempDir(),
+		},
+	)
+	require.Error(t, err)
+}
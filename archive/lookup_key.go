@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/draganm/linear/keyindex"
+)
+
+// LookupKey returns the archived indexes of entries with the given application key in ascending order.
+// Blobs archived without a key index are not searched.
+func (a *Archive) LookupKey(ctx context.Context, key string) ([]uint64, error) {
+	defer a.startRead()()
+
+	a.readLock.RLock()
+	blobMaps := slices.Clone(a.archivedBlobMaps)
+	a.readLock.RUnlock()
+
+	indexes := []uint64{}
+
+	for _, bm := range blobMaps {
+		if bm.keyIndexKey == "" {
+			continue
+		}
+
+		idx, err := a.loadKeyIndex(ctx, bm.keyIndexKey)
+		if err != nil {
+			return nil, err
+		}
+
+		indexes = append(indexes, idx.Lookup(key)...)
+	}
+
+	return indexes, nil
+}
+
+func (a *Archive) loadKeyIndex(ctx context.Context, key string) (keyindex.Index, error) {
+	idx, err := a.keyIndexCache.Get(key, func() (keyindex.Index, uint64, error) {
+		r, err := a.store.Get(ctx, key)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get key index: %w", err)
+		}
+		defer r.Close()
+
+		d, err := io.ReadAll(r)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read key index: %w", err)
+		}
+
+		idx, err := keyindex.Unmarshal(d)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return idx, uint64(len(d)), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key index %s: %w", key, err)
+	}
+
+	return idx, nil
+}
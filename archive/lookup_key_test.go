@@ -0,0 +1,66 @@
+package archive_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/e2eutils"
+	"github.com/draganm/linear/keyindex"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupKey(t *testing.T) {
+
+	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
+
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 100; i++ {
+			err = sm.Append(i, []byte{byte(i % 3), byte(i)})
+			require.NoError(t, err)
+		}
+
+		opts := archive.OpenOptions{
+			Store:        objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
+			Name:         "test-archive",
+			BlobmapCache: bmc,
+			WorkDir:      t.TempDir(),
+			KeyExtractor: keyindex.ByteRangeExtractor(0, 1),
+		}
+
+		log := slogt.New(t)
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		err = ar.Append(ctx, sm)
+		require.NoError(t, err)
+
+		arch, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		indexes, err := arch.LookupKey(ctx, "02")
+		require.NoError(t, err)
+
+		expected := []uint64{}
+		for i := uint64(2); i < 100; i += 3 {
+			expected = append(expected, i)
+		}
+
+		require.Equal(t, expected, indexes)
+
+		indexes, err = arch.LookupKey(ctx, "03")
+		require.NoError(t, err)
+		require.Empty(t, indexes)
+	})
+}
@@ -0,0 +1,219 @@
+package archive_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+// layoutBlob is a blob of a random layout, its entries hold the index followed by the id of the blob.
+type layoutBlob struct {
+	id       byte
+	from, to uint64
+}
+
+// layoutModel tracks the blobs an archive serves reads from, following the rules of Archive.Append.
+type layoutModel []layoutBlob
+
+func (m layoutModel) add(b layoutBlob) layoutModel {
+	for _, r := range m {
+		if r.from <= b.from && b.to <= r.to && (r.from != b.from || r.to != b.to) {
+			return m
+		}
+	}
+
+	kept := layoutModel{}
+	for _, r := range m {
+		if !(b.from <= r.from && r.to <= b.to) {
+			kept = append(kept, r)
+		}
+	}
+
+	return append(kept, b)
+}
+
+// holder returns the id of the blob an index is read from.
+func (m layoutModel) holder(index uint64) (byte, bool) {
+	var best layoutBlob
+	ok := false
+	for _, b := range m {
+		if index < b.from || index > b.to {
+			continue
+		}
+		if !ok || b.to-b.from > best.to-best.from || (b.to-b.from == best.to-best.from && b.id > best.id) {
+			best = b
+			ok = true
+		}
+	}
+	return best.id, ok
+}
+
+func TestReadPlanRandomLayouts(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	const span = 200
+
+	// blobs cannot include math.MaxUint64, which is still read past
+	bases := []uint64{0, 1 << 63, math.MaxUint64 - span}
+
+	for iteration := 0; iteration < 60; iteration++ {
+		base := bases[iteration%len(bases)]
+
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+
+		opts := archive.OpenOptions{
+			Store:        objectstore.NewMemory(),
+			Name:         "test-archive",
+			BlobmapCache: bmc,
+			WorkDir:      t.TempDir(),
+		}
+		if iteration%2 == 1 {
+			opts.RangedReadThreshold = math.MaxUint64
+		}
+
+		ar, err := archive.Open(ctx, slogt.New(t), opts)
+		require.NoError(t, err)
+
+		model := layoutModel{}
+
+		blobs := byte(1 + rnd.IntN(12))
+		for id := byte(1); id <= blobs; id++ {
+			from := base + rnd.Uint64N(span)
+			to := from + rnd.Uint64N(min(30, base+span-1-from+1))
+
+			sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+			require.NoError(t, err)
+			for i := from; ; i++ {
+				require.NoError(t, sm.Append(i, append(binary.BigEndian.AppendUint64(nil, i), id)))
+				if i == to {
+					break
+				}
+			}
+			require.NoError(t, ar.Append(ctx, sm))
+			require.NoError(t, sm.Close())
+
+			model = model.add(layoutBlob{id: id, from: from, to: to})
+		}
+
+		for read := 0; read < 20; read++ {
+			reverse := rnd.IntN(2) == 1
+
+			start := base + rnd.Uint64N(span)
+			count := 1 + rnd.Uint64N(40)
+			if rnd.IntN(10) == 0 {
+				count = math.MaxUint64
+			}
+
+			// the range read, clamped to the index space
+			from, to := start, start
+			if reverse {
+				from = 0
+				if count <= start {
+					from = start - count + 1
+				}
+			} else {
+				to = math.MaxUint64
+				if count-1 <= math.MaxUint64-start {
+					to = start + count - 1
+				}
+			}
+
+			indexes := []uint64{}
+			fn := func(ctx context.Context, index uint64, data []byte) error {
+				require.Equal(t, index, binary.BigEndian.Uint64(data))
+				id, _ := model.holder(index)
+				require.Equal(t, id, data[8], "index %d is read from the wrong blob", index)
+				indexes = append(indexes, index)
+				return nil
+			}
+
+			if reverse {
+				err = ar.ReadReverse(ctx, start, count, fn)
+			} else {
+				err = ar.Read(ctx, start, count, fn)
+			}
+
+			gap, hasGap := expectedGap(model, from, to, base, base+span-1, reverse)
+			if hasGap {
+				var notArchived *archive.ErrRangeNotArchived
+				require.True(t, errors.As(err, &notArchived), "expected a gap, got %v", err)
+				require.Equal(t, gap, *notArchived)
+				require.Empty(t, indexes)
+				continue
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, to-from+1, uint64(len(indexes)))
+			for n, index := range indexes {
+				if reverse {
+					require.Equal(t, to-uint64(n), index)
+				} else {
+					require.Equal(t, from+uint64(n), index)
+				}
+			}
+		}
+
+		bmc.Close()
+	}
+}
+
+// expectedGap returns the first gap met reading [from, to] in the given direction.
+// Only indexes in [low, high] can be archived.
+func expectedGap(model layoutModel, from, to, low, high uint64, reverse bool) (archive.ErrRangeNotArchived, bool) {
+	covered := func(i uint64) bool {
+		if i < low || i > high {
+			return false
+		}
+		_, ok := model.holder(i)
+		return ok
+	}
+
+	if !reverse {
+		for p := from; ; p++ {
+			if !covered(p) {
+				gapTo := p
+				for gapTo < to && !covered(gapTo+1) {
+					if gapTo >= high {
+						gapTo = to
+						break
+					}
+					gapTo++
+				}
+				return archive.ErrRangeNotArchived{From: p, To: gapTo}, true
+			}
+			if p == to {
+				return archive.ErrRangeNotArchived{}, false
+			}
+		}
+	}
+
+	for p := to; ; p-- {
+		if !covered(p) {
+			gapFrom := p
+			for gapFrom > from && !covered(gapFrom-1) {
+				if gapFrom <= low {
+					gapFrom = from
+					break
+				}
+				gapFrom--
+			}
+			return archive.ErrRangeNotArchived{From: gapFrom, To: p}, true
+		}
+		if p == from {
+			return archive.ErrRangeNotArchived{}, false
+		}
+	}
+}
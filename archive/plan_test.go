@@ -0,0 +1,109 @@
+package archive_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPlanGapsAndOverlaps(t *testing.T) {
+	ctx := context.Background()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	opts := archive.OpenOptions{
+		Store:        objectstore.NewMemory(),
+		Name:         "test-archive",
+		BlobmapCache: bmc,
+		WorkDir:      t.TempDir(),
+	}
+
+	log := slogt.New(t)
+	ar, err := archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	// blob is the second byte of every entry
+	appendRange := func(from, to uint64, blob byte) {
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+		defer sm.Close()
+
+		for i := from; i <= to; i++ {
+			require.NoError(t, sm.Append(i, []byte{byte(i), blob}))
+		}
+
+		require.NoError(t, ar.Append(ctx, sm))
+	}
+
+	appendRange(0, 49, 1)
+	appendRange(40, 99, 2)
+	appendRange(10, 19, 3)
+	appendRange(120, 129, 4)
+
+	for _, reopen := range []bool{false, true} {
+		if reopen {
+			ar, err = archive.Open(ctx, log, opts)
+			require.NoError(t, err)
+		}
+
+		read := func(from, count uint64, reverse bool) ([]uint64, map[uint64]byte, error) {
+			indexes := []uint64{}
+			blobs := map[uint64]byte{}
+			fn := func(ctx context.Context, index uint64, data []byte) error {
+				require.Equal(t, byte(index), data[0])
+				indexes = append(indexes, index)
+				blobs[index] = data[1]
+				return nil
+			}
+			if reverse {
+				return indexes, blobs, ar.ReadReverse(ctx, from, count, fn)
+			}
+			return indexes, blobs, ar.Read(ctx, from, count, fn)
+		}
+
+		indexes, blobs, err := read(0, 100, false)
+		require.NoError(t, err)
+		require.Len(t, indexes, 100)
+		for i, index := range indexes {
+			require.Equal(t, uint64(i), index)
+		}
+		require.Equal(t, byte(1), blobs[15])
+		require.Equal(t, byte(2), blobs[45], "the larger blob is preferred")
+
+		_, blobs, err = read(45, 1, false)
+		require.NoError(t, err)
+		require.Equal(t, byte(2), blobs[45])
+
+		indexes, blobs, err = read(99, 100, true)
+		require.NoError(t, err)
+		require.Len(t, indexes, 100)
+		require.Equal(t, uint64(99), indexes[0])
+		require.Equal(t, uint64(0), indexes[99])
+		require.Equal(t, byte(2), blobs[45])
+
+		var notArchived *archive.ErrRangeNotArchived
+
+		indexes, _, err = read(95, 30, false)
+		require.ErrorAs(t, err, &notArchived)
+		require.Equal(t, archive.ErrRangeNotArchived{From: 100, To: 119}, *notArchived)
+		require.Empty(t, indexes)
+
+		indexes, _, err = read(125, 30, true)
+		require.ErrorAs(t, err, &notArchived)
+		require.Equal(t, archive.ErrRangeNotArchived{From: 100, To: 119}, *notArchived)
+		require.Empty(t, indexes)
+
+		_, _, err = read(130, 5, false)
+		require.ErrorAs(t, err, &notArchived)
+		require.Equal(t, archive.ErrRangeNotArchived{From: 130, To: 134}, *notArchived)
+	}
+}
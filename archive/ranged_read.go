@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/draganm/linear/objectstore"
+)
+
+// blobmap layout: 16 bytes header, 8 bytes end offset per entry, data, 8 bytes checksum
+const blobmapHeaderSize = 16
+
+func (a *Archive) useRangedRead(step readPlanStep) bool {
+	if a.rangedThreshold == 0 || isLocal(step.store) || a.blobMapsCache.Has(step.blobmapKey) {
+		return false
+	}
+
+	entries := step.blobTo - step.blobFrom + 1
+	estimate := step.size / entries * step.count
+
+	return estimate < a.rangedThreshold
+}
+
+func getRange(ctx context.Context, store objectstore.Store, key string, offset, length uint64) ([]byte, error) {
+	r, err := store.GetRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	d := make([]byte, length)
+	_, err = io.ReadFull(r, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read range of %s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+// readRanged reads the entries of a step by fetching the end offsets of the entries
+// and then the data of the entries, without downloading the whole blobmap.
+func (a *Archive) readRanged(
+	ctx context.Context,
+	step readPlanStep,
+	readFn func(ctx context.Context, index uint64, data []byte) error,
+) error {
+	entries := step.blobTo - step.blobFrom + 1
+	first := step.from - step.blobFrom
+	last := first + step.count - 1
+
+	// the start of an entry is the end of the previous one
+	positionsFrom := first
+	if first > 0 {
+		positionsFrom = first - 1
+	}
+
+	positions, err := getRange(ctx, step.store, step.blobmapKey, blobmapHeaderSize+positionsFrom*8, (last-positionsFrom+1)*8)
+	if err != nil {
+		return err
+	}
+
+	endOf := func(rel uint64) uint64 {
+		return binary.BigEndian.Uint64(positions[(rel-positionsFrom)*8:])
+	}
+
+	startOf := func(rel uint64) uint64 {
+		if rel == 0 {
+			return 0
+		}
+		return endOf(rel - 1)
+	}
+
+	dataStart := startOf(first)
+	dataEnd := endOf(last)
+
+	data := []byte{}
+	if dataEnd > dataStart {
+		data, err = getRange(ctx, step.store, step.blobmapKey, blobmapHeaderSize+entries*8+dataStart, dataEnd-dataStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	for n := uint64(0); n < step.count; n++ {
+		rel := first + n
+		if step.reverse {
+			rel = last - n
+		}
+
+		i := step.blobFrom + rel
+
+		err = readFn(ctx, i, data[startOf(rel)-dataStart:endOf(rel)-dataStart])
+		if err != nil {
+			return fmt.Errorf("failed to process data %d from blobmap %s: %w", i, step.blobmapKey, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/e2eutils"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangedRead(t *testing.T) {
+
+	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
+
+		cacheDir := t.TempDir()
+		bmc, err := blobmapcache.Open(cacheDir, 50*1024*1024)
+		require.NoError(t, err)
+
+		opts := archive.OpenOptions{
+			Store:               objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
+			Name:                "test-archive",
+			BlobmapCache:        bmc,
+			WorkDir:             t.TempDir(),
+			RangedReadThreshold: 1024 * 1024,
+		}
+
+		entry := func(i uint64) []byte {
+			return bytes.Repeat([]byte{byte(i)}, int(i%5))
+		}
+
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+
+		for i := uint64(10); i < 110; i++ {
+			err = sm.Append(i, entry(i))
+			require.NoError(t, err)
+		}
+
+		log := slogt.New(t)
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		err = ar.Append(ctx, sm)
+		require.NoError(t, err)
+
+		ar, err = archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		collect := func(indexes *[]uint64) func(ctx context.Context, index uint64, data []byte) error {
+			return func(ctx context.Context, index uint64, data []byte) error {
+				require.Equal(t, entry(index), data)
+				*indexes = append(*indexes, index)
+				return nil
+			}
+		}
+
+		indexes := []uint64{}
+		err = ar.Read(ctx, 10, 3, collect(&indexes))
+		require.NoError(t, err)
+		require.Equal(t, []uint64{10, 11, 12}, indexes)
+
+		indexes = []uint64{}
+		err = ar.Read(ctx, 55, 1, collect(&indexes))
+		require.NoError(t, err)
+		require.Equal(t, []uint64{55}, indexes)
+
+		indexes = []uint64{}
+		err = ar.ReadReverse(ctx, 109, 3, collect(&indexes))
+		require.NoError(t, err)
+		require.Equal(t, []uint64{109, 108, 107}, indexes)
+
+		cached, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		require.Empty(t, cached)
+	})
+}
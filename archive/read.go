@@ -1,106 +1,418 @@
 package archive
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"slices"
+	"sync"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/draganm/blobmap"
+	"github.com/draganm/linear/objectstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type readPlanStep struct {
 	from       uint64
 	count      uint64
 	blobmapKey string
+	size       uint64
+	blobFrom   uint64
+	blobTo     uint64
+	store      objectstore.Store
+	reverse    bool
 }
 
+// ErrRangeNotArchived is returned by reads of indexes missing from the archive.
+type ErrRangeNotArchived struct {
+	From uint64
+	To   uint64
+}
+
+func (e *ErrRangeNotArchived) Error() string {
+	return fmt.Sprintf("indexes %d-%d are not archived", e.From, e.To)
+}
+
+// Read calls readFn for archived entries in [from, from+count) in ascending order.
+// Nothing is read if any of the entries is missing, the error is then an *ErrRangeNotArchived.
 func (a *Archive) Read(
 	ctx context.Context,
 	from, count uint64,
 	readFn func(ctx context.Context, index uint64, data []byte) error,
-) error {
+) (err error) {
+	if count == 0 {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "archive.Read", trace.WithAttributes(
+		attribute.Int64("linear.from", int64(from)),
+		attribute.Int64("linear.count", int64(count)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	to := uint64(math.MaxUint64)
+	if count-1 <= math.MaxUint64-from {
+		to = from + count - 1
+	}
+
+	defer a.startRead()()
+
+	a.readLock.RLock()
+	readPlan, err := a.planRead(from, to, false)
+	a.readLock.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("linear.plan_steps", len(readPlan)))
+
+	return a.executeReadPlan(ctx, readPlan, readFn)
+}
+
+// ReadReverse calls readFn for archived entries in [to-count+1, to] in descending order, stopping at index 0.
+// Nothing is read if any of the entries is missing, the error is then an *ErrRangeNotArchived.
+func (a *Archive) ReadReverse(
+	ctx context.Context,
+	to, count uint64,
+	readFn func(ctx context.Context, index uint64, data []byte) error,
+) (err error) {
+	if count == 0 {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "archive.ReadReverse", trace.WithAttributes(
+		attribute.Int64("linear.to", int64(to)),
+		attribute.Int64("linear.count", int64(count)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	from := uint64(0)
+	if count <= to {
+		from = to - count + 1
+	}
+
+	defer a.startRead()()
+
 	a.readLock.RLock()
+	readPlan, err := a.planRead(from, to, true)
+	a.readLock.RUnlock()
+
+	if err != nil {
+		return err
+	}
 
+	span.SetAttributes(attribute.Int("linear.plan_steps", len(readPlan)))
+
+	return a.executeReadPlan(ctx, readPlan, readFn)
+}
+
+// planRead plans reading [from, to], each index from exactly one blob.
+// Blobs never contain each other, so sorted by from they are also sorted by to, and the blobs
+// holding an index are adjacent. Where blobs overlap, every index is read from the largest
+// and then the newest blob holding it, regardless of the range read.
+// The caller must hold readLock.
+func (a *Archive) planRead(from, to uint64, reverse bool) ([]readPlanStep, error) {
+	blobMaps := a.archivedBlobMaps
 	readPlan := []readPlanStep{}
 
-	for _, bm := range a.archivedBlobMaps {
-		if from >= bm.from && from <= bm.to {
-			if from+count-1 <= bm.to {
-				readPlan = append(readPlan, readPlanStep{
-					from:       from,
-					count:      count,
-					blobmapKey: bm.key,
-				})
-				break
+	step := func(bm archivedBlobMap, from, to uint64) readPlanStep {
+		return readPlanStep{
+			from:       from,
+			count:      to - from + 1,
+			blobmapKey: bm.key,
+			size:       bm.size,
+			blobFrom:   bm.from,
+			blobTo:     bm.to,
+			store:      a.storeFor(bm.tier),
+			reverse:    reverse,
+		}
+	}
+
+	if !reverse {
+		for p := from; ; {
+			bm, ok := holding(blobMaps, p)
+
+			// the first blob starting after p, where the preferred blob can change
+			next, found := slices.BinarySearchFunc(blobMaps, p, compareFrom)
+			if found {
+				next++
+			}
+
+			stepTo := to
+			if next < len(blobMaps) && blobMaps[next].from-1 < stepTo {
+				stepTo = blobMaps[next].from - 1
 			}
-			readPlan = append(readPlan, readPlanStep{
-				from:       from,
-				count:      bm.to - from + 1,
-				blobmapKey: bm.key,
-			})
-			from = bm.to + 1
 
+			if !ok {
+				return nil, &ErrRangeNotArchived{From: p, To: stepTo}
+			}
+
+			stepTo = min(stepTo, bm.to)
+			readPlan = append(readPlan, step(bm, p, stepTo))
+			if stepTo == to {
+				return readPlan, nil
+			}
+			p = stepTo + 1
 		}
 	}
 
-	a.readLock.RUnlock()
+	for p := to; ; {
+		bm, ok := holding(blobMaps, p)
+
+		// blobs before prev end before p, the last of them is where the preferred blob can change
+		prev, _ := slices.BinarySearchFunc(blobMaps, p, compareTo)
+
+		stepFrom := from
+		if prev > 0 && blobMaps[prev-1].to+1 > stepFrom {
+			stepFrom = blobMaps[prev-1].to + 1
+		}
+
+		if !ok {
+			return nil, &ErrRangeNotArchived{From: stepFrom, To: p}
+		}
+
+		stepFrom = max(stepFrom, bm.from)
+		readPlan = append(readPlan, step(bm, stepFrom, p))
+		if stepFrom == from {
+			return readPlan, nil
+		}
+		p = stepFrom - 1
+	}
+}
+
+func compareFrom(bm archivedBlobMap, index uint64) int {
+	return cmp.Compare(bm.from, index)
+}
+
+func compareTo(bm archivedBlobMap, index uint64) int {
+	return cmp.Compare(bm.to, index)
+}
+
+// holding returns the blob preferred for reading index, which is the largest and then the newest blob holding it.
+func holding(blobMaps []archivedBlobMap, index uint64) (archivedBlobMap, bool) {
+	// number of blobs starting at or before index
+	n, found := slices.BinarySearchFunc(blobMaps, index, compareFrom)
+	if found {
+		n++
+	}
+
+	var best archivedBlobMap
+	ok := false
+
+	for i := n - 1; i >= 0 && blobMaps[i].to >= index; i-- {
+		bm := blobMaps[i]
+		if !ok || preferred(bm, best) {
+			best = bm
+			ok = true
+		}
+	}
+
+	return best, ok
+}
+
+func preferred(a, b archivedBlobMap) bool {
+	sizeA, sizeB := a.to-a.from, b.to-b.from
+	if sizeA != sizeB {
+		return sizeA > sizeB
+	}
+	return a.lastModified.After(b.lastModified)
+}
 
-	for _, step := range readPlan {
-
-		err := a.blobMapsCache.WithBlobmap(
-			ctx,
-			step.blobmapKey,
-			func(ctx context.Context, path string) error {
-				res, err := a.s3Client.GetObject(
-					ctx,
-					&s3.GetObjectInput{
-						Bucket: aws.String(a.s3Bucket),
-						Key:    aws.String(step.blobmapKey),
-					},
-				)
-				if err != nil {
-					return fmt.Errorf("failed to get blobmap: %w", err)
-				}
-				defer res.Body.Close()
-
-				w, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
-				if err != nil {
-					return fmt.Errorf("failed to open blobmap file: %w", err)
-				}
-				defer w.Close()
-
-				_, err = io.Copy(w, res.Body)
-				if err != nil {
-					return fmt.Errorf("failed to write blobmap file: %w", err)
-				}
-
-				return nil
-			},
-			func(ctx context.Context, b *blobmap.Reader) error {
-				for i := step.from; i < step.from+step.count; i++ {
-					data, err := b.Read(i)
-					if err != nil {
-						return fmt.Errorf("failed to read data %d from blobmap %s: %w", i, step.blobmapKey, err)
-					}
-
-					err = readFn(ctx, i, data)
-					if err != nil {
-						return fmt.Errorf("failed to process data %d from blobmap %s: %w", i, step.blobmapKey, err)
-					}
-				}
-
-				return nil
-			},
-		)
+// loadBlobmap downloads a blobmap into the file, using the downloader of the store if it has one.
+func loadBlobmap(ctx context.Context, store objectstore.Store, key, path string) error {
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open blobmap file: %w", err)
+	}
+	defer w.Close()
+
+	downloader, ok := store.(objectstore.Downloader)
+	if ok {
+		err = downloader.Download(ctx, key, w)
+		if err != nil {
+			return fmt.Errorf("failed to download blobmap: %w", err)
+		}
+		return nil
+	}
+
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to get blobmap: %w", err)
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	if err != nil {
+		return fmt.Errorf("failed to write blobmap file: %w", err)
+	}
+
+	return nil
+}
+
+// prefetch starts loading the blobmaps of the steps following step n into the cache,
+// as long as they fit into the cache together with the blobmap of step n.
+// next is the first step that has not been prefetched yet.
+func (a *Archive) prefetch(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	readPlan []readPlanStep,
+	n int,
+	next *int,
+) {
+	budget := a.blobMapsCache.MaxSize()
+	planned := readPlan[n].size
+
+	for j := n + 1; j < len(readPlan) && j <= n+a.readAhead; j++ {
+		planned += readPlan[j].size
+		if planned > budget {
+			return
+		}
+
+		if j < *next || a.useRangedRead(readPlan[j]) || isLocal(readPlan[j].store) {
+			continue
+		}
+
+		*next = j + 1
+
+		key := readPlan[j].blobmapKey
+		store := readPlan[j].store
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := a.blobMapsCache.WithBlobmap(
+				ctx,
+				key,
+				func(ctx context.Context, path string) error {
+					return loadBlobmap(ctx, store, key, path)
+				},
+				func(ctx context.Context, b *blobmap.Reader) error {
+					return nil
+				},
+			)
+			if err != nil && ctx.Err() == nil {
+				a.log.Warn("failed to prefetch blobmap", "key", key, "error", err)
+			}
+		}()
+	}
+}
+
+func (a *Archive) executeReadPlan(
+	ctx context.Context,
+	readPlan []readPlanStep,
+	readFn func(ctx context.Context, index uint64, data []byte) error,
+) error {
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	prefetchCtx, cancelPrefetch := context.WithCancel(ctx)
+	defer cancelPrefetch()
+
+	stop := context.AfterFunc(a.closed, cancelPrefetch)
+	defer stop()
+
+	nextPrefetch := 0
+
+	for n, step := range readPlan {
+
+		if a.readAhead > 0 {
+			a.prefetch(prefetchCtx, wg, readPlan, n, &nextPrefetch)
+		}
+
+		err := a.executeReadStep(ctx, step, readFn)
 		if err != nil {
 			return err
 		}
+	}
+
+	return nil
+
+}
+
+// executeReadStep reads a step with a ranged read, from a local file or from the blobmap cache.
+func (a *Archive) executeReadStep(
+	ctx context.Context,
+	step readPlanStep,
+	readFn func(ctx context.Context, index uint64, data []byte) error,
+) (err error) {
+	ctx, span := tracer.Start(ctx, "archive.readStep", trace.WithAttributes(
+		attribute.String("linear.key", step.blobmapKey),
+		attribute.Int64("linear.from", int64(step.from)),
+		attribute.Int64("linear.count", int64(step.count)),
+	))
+	defer func() { endSpan(span, err) }()
 
+	if a.useRangedRead(step) {
+		span.SetAttributes(attribute.String("linear.read_mode", "ranged"))
+		return a.readRanged(ctx, step, readFn)
+	}
+
+	localFiles, ok := step.store.(objectstore.LocalFiles)
+	if ok {
+		span.SetAttributes(attribute.String("linear.read_mode", "local"))
+		return readLocal(ctx, localFiles, step, readFn)
+	}
+
+	span.SetAttributes(attribute.String("linear.read_mode", "cached"))
+	return a.blobMapsCache.WithBlobmap(
+		ctx,
+		step.blobmapKey,
+		func(ctx context.Context, path string) error {
+			return loadBlobmap(ctx, step.store, step.blobmapKey, path)
+		},
+		func(ctx context.Context, b *blobmap.Reader) error {
+			return readStep(ctx, step, b, readFn)
+		},
+	)
+}
+
+// readLocal reads a step straight from the blobmap file of a store keeping objects in local files.
+func readLocal(
+	ctx context.Context,
+	localFiles objectstore.LocalFiles,
+	step readPlanStep,
+	readFn func(ctx context.Context, index uint64, data []byte) error,
+) error {
+	b, err := blobmap.Open(localFiles.LocalPath(step.blobmapKey))
+	if err != nil {
+		return fmt.Errorf("failed to open blobmap %s: %w", step.blobmapKey, err)
+	}
+	defer b.Close()
+
+	return readStep(ctx, step, b, readFn)
+}
+
+func readStep(
+	ctx context.Context,
+	step readPlanStep,
+	b *blobmap.Reader,
+	readFn func(ctx context.Context, index uint64, data []byte) error,
+) error {
+	for n := uint64(0); n < step.count; n++ {
+		i := step.from + n
+		if step.reverse {
+			i = step.from + step.count - 1 - n
+		}
+
+		data, err := b.Read(i)
+		if err != nil {
+			return fmt.Errorf("failed to read data %d from blobmap %s: %w", i, step.blobmapKey, err)
+		}
+
+		err = readFn(ctx, i, data)
+		if err != nil {
+			return fmt.Errorf("failed to process data %d from blobmap %s: %w", i, step.blobmapKey, err)
+		}
 	}
 
 	return nil
+}
 
+func isLocal(store objectstore.Store) bool {
+	_, ok := store.(objectstore.LocalFiles)
+	return ok
 }
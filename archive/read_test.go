@@ -0,0 +1,196 @@
+package archive_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/e2eutils"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+
+	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
+
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+
+		opts := archive.OpenOptions{
+			Store:        objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
+			Name:         "test-archive",
+			BlobmapCache: bmc,
+			WorkDir:      t.TempDir(),
+		}
+
+		log := slogt.New(t)
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		for _, r := range [][2]uint64{{0, 49}, {50, 99}} {
+			sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+			require.NoError(t, err)
+
+			for i := r[0]; i <= r[1]; i++ {
+				err = sm.Append(i, []byte{byte(i)})
+				require.NoError(t, err)
+			}
+
+			err = ar.Append(ctx, sm)
+			require.NoError(t, err)
+			require.NoError(t, sm.Close())
+		}
+
+		ar, err = archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		collect := func(indexes *[]uint64) func(ctx context.Context, index uint64, data []byte) error {
+			return func(ctx context.Context, index uint64, data []byte) error {
+				require.Equal(t, []byte{byte(index)}, data)
+				*indexes = append(*indexes, index)
+				return nil
+			}
+		}
+
+		t.Run("forward across blobs", func(t *testing.T) {
+			indexes := []uint64{}
+			err := ar.Read(ctx, 48, 4, collect(&indexes))
+			require.NoError(t, err)
+			require.Equal(t, []uint64{48, 49, 50, 51}, indexes)
+		})
+
+		t.Run("reverse across blobs", func(t *testing.T) {
+			indexes := []uint64{}
+			err := ar.ReadReverse(ctx, 51, 4, collect(&indexes))
+			require.NoError(t, err)
+			require.Equal(t, []uint64{51, 50, 49, 48}, indexes)
+		})
+
+		t.Run("reverse to the first index", func(t *testing.T) {
+			indexes := []uint64{}
+			err := ar.ReadReverse(ctx, 2, 10, collect(&indexes))
+			require.NoError(t, err)
+			require.Equal(t, []uint64{2, 1, 0}, indexes)
+		})
+	})
+}
+
+func TestReadAhead(t *testing.T) {
+
+	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
+
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+
+		opts := archive.OpenOptions{
+			Store:        objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
+			Name:         "test-archive",
+			BlobmapCache: bmc,
+			WorkDir:      t.TempDir(),
+			ReadAhead:    2,
+		}
+
+		log := slogt.New(t)
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		for from := uint64(0); from < 100; from += 10 {
+			sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+			require.NoError(t, err)
+
+			for i := from; i < from+10; i++ {
+				err = sm.Append(i, []byte{byte(i)})
+				require.NoError(t, err)
+			}
+
+			err = ar.Append(ctx, sm)
+			require.NoError(t, err)
+			require.NoError(t, sm.Close())
+		}
+
+		// a fresh cache holds only what the read loads
+		opts.BlobmapCache, err = blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+
+		ar, err = archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		blobs := ar.Blobs()
+		require.Len(t, blobs, 10)
+		require.False(t, opts.BlobmapCache.Has(blobs[1].Key))
+
+		indexes := []uint64{}
+		err = ar.Read(ctx, 5, 90, func(ctx context.Context, index uint64, data []byte) error {
+			if index == 5 {
+				// the read is still in the first blob, the next two are loaded ahead of it
+				require.Eventually(t, func() bool {
+					return opts.BlobmapCache.Has(blobs[1].Key) && opts.BlobmapCache.Has(blobs[2].Key)
+				}, 5*time.Second, 10*time.Millisecond)
+				require.False(t, opts.BlobmapCache.Has(blobs[3].Key))
+			}
+			require.Equal(t, []byte{byte(index)}, data)
+			indexes = append(indexes, index)
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Len(t, indexes, 90)
+		require.Equal(t, uint64(5), indexes[0])
+		require.Equal(t, uint64(94), indexes[89])
+	})
+}
+
+func TestReadDownloadsInParts(t *testing.T) {
+
+	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
+
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+
+		opts := archive.OpenOptions{
+			Store: objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{
+				Download: objectstore.DownloadOptions{
+					PartSize:    64,
+					Concurrency: 3,
+				},
+			}),
+			Name:         "test-archive",
+			BlobmapCache: bmc,
+			WorkDir:      t.TempDir(),
+		}
+
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 100; i++ {
+			err = sm.Append(i, []byte{byte(i), byte(i), byte(i)})
+			require.NoError(t, err)
+		}
+
+		log := slogt.New(t)
+		ar, err := archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		err = ar.Append(ctx, sm)
+		require.NoError(t, err)
+
+		ar, err = archive.Open(ctx, log, opts)
+		require.NoError(t, err)
+
+		count := 0
+		err = ar.Read(ctx, 0, 100, func(ctx context.Context, index uint64, data []byte) error {
+			require.Equal(t, []byte{byte(index), byte(index), byte(index)}, data)
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 100, count)
+	})
+}
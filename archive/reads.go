@@ -0,0 +1,44 @@
+package archive
+
+import (
+	"context"
+	"sync"
+)
+
+// readEpoch counts the reads that planned against the blobs of the archive between two changes
+// replacing blobs.
+type readEpoch struct {
+	reads sync.WaitGroup
+}
+
+// startRead registers a read before it plans against the current blobs, done is called once the
+// read has finished.
+func (a *Archive) startRead() (done func()) {
+	a.epochLock.Lock()
+	defer a.epochLock.Unlock()
+
+	e := a.epoch
+	e.reads.Add(1)
+	return e.reads.Done
+}
+
+// drainReads waits for the reads started before the call, which may still use blobs replaced since.
+func (a *Archive) drainReads(ctx context.Context) error {
+	a.epochLock.Lock()
+	e := a.epoch
+	a.epoch = &readEpoch{}
+	a.epochLock.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		e.reads.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"context"
+	"time"
+)
+
+// Refresh re-lists the archive and tier stores, picking up blobs appended, compacted or moved by other processes.
+func (a *Archive) Refresh(ctx context.Context) error {
+	a.maintenanceLock.Lock()
+	defer a.maintenanceLock.Unlock()
+
+	a.appendLock.Lock()
+	defer a.appendLock.Unlock()
+
+	blobMaps, manifest, staleKeys, err := listBlobMaps(ctx, a.log, a.store, a.name, a.tiers)
+	if err != nil {
+		return err
+	}
+
+	a.tierManifest = manifest
+
+	a.readLock.Lock()
+	a.archivedBlobMaps = blobMaps
+	a.archivedBytes = totalSize(blobMaps)
+	// superseded objects of this process that are not deleted yet are not necessarily listed again
+	a.staleKeys = append(a.staleKeys, staleKeys...)
+	a.readLock.Unlock()
+
+	return nil
+}
+
+func (a *Archive) startRefresh(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopRefresh = cancel
+	a.refreshDone = make(chan struct{})
+
+	go func() {
+		defer close(a.refreshDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := a.Refresh(ctx)
+			if err != nil && ctx.Err() == nil {
+				a.log.Error("failed to refresh archive", "error", err)
+			}
+		}
+	}()
+}
+
+// Close stops refreshing the archive and cancels the prefetches of reads still running.
+func (a *Archive) Close() error {
+	a.cancelClose()
+
+	if a.stopRefresh != nil {
+		a.stopRefresh()
+		<-a.refreshDone
+	}
+	return nil
+}
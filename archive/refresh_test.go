@@ -0,0 +1,93 @@
+package archive_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	store := objectstore.NewMemory()
+
+	open := func(refreshInterval time.Duration) *archive.Archive {
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+		t.Cleanup(func() { bmc.Close() })
+
+		ar, err := archive.Open(ctx, slogt.New(t), archive.OpenOptions{
+			Store:           store,
+			Name:            "test-archive",
+			BlobmapCache:    bmc,
+			WorkDir:         t.TempDir(),
+			RefreshInterval: refreshInterval,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { ar.Close() })
+		return ar
+	}
+
+	writer := open(0)
+	replica := open(10 * time.Millisecond)
+
+	appendRange := func(from, to uint64) {
+		sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+		require.NoError(t, err)
+		defer sm.Close()
+
+		for i := from; i <= to; i++ {
+			require.NoError(t, sm.Append(i, []byte{byte(i)}))
+		}
+
+		require.NoError(t, writer.Append(ctx, sm))
+	}
+
+	appendRange(0, 9)
+
+	first, last, ok := writer.Bounds()
+	require.True(t, ok)
+	require.Equal(t, uint64(0), first)
+	require.Equal(t, uint64(9), last)
+
+	err := writer.Read(ctx, 5, 1, func(ctx context.Context, index uint64, data []byte) error {
+		require.Equal(t, []byte{5}, data)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, last, ok := replica.Bounds()
+		return ok && last == 9
+	}, 5*time.Second, 10*time.Millisecond)
+
+	appendRange(10, 19)
+
+	require.Eventually(t, func() bool {
+		_, last, ok := replica.Bounds()
+		return ok && last == 19
+	}, 5*time.Second, 10*time.Millisecond)
+
+	count := 0
+	err = replica.Read(ctx, 0, 20, func(ctx context.Context, index uint64, data []byte) error {
+		require.Equal(t, []byte{byte(index)}, data)
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 20, count)
+
+	other := open(0)
+	appendRange(20, 29)
+	require.NoError(t, other.Refresh(ctx))
+	_, last, _ = other.Bounds()
+	require.Equal(t, uint64(29), last)
+}
@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/draganm/linear/objectstore"
+)
+
+// TieringRule moves blobs older than MinAge to the tier store named Tier.
+// When several rules match a blob, the one with the largest MinAge wins.
+type TieringRule struct {
+	MinAge time.Duration `json:"min_age"`
+	Tier   string        `json:"tier"`
+}
+
+type tierEntry struct {
+	Tier string `json:"tier,omitempty"`
+	Size uint64 `json:"size,omitempty"`
+	// Created is the age of the blob for tiering rules if it differs from the upload time
+	Created time.Time `json:"created"`
+}
+
+// tierManifest maps keys of blobs that are not in the archive store to the tier holding them.
+// Entries without a tier keep the age of compacted blobs in the archive store, which is the
+// age of their oldest source.
+type tierManifest map[string]tierEntry
+
+func tierManifestKey(name string) string {
+	return path.Join(name, "tiers.json")
+}
+
+func loadTierManifest(ctx context.Context, store objectstore.Store, name string) (tierManifest, error) {
+	r, err := store.Get(ctx, tierManifestKey(name))
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return tierManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tier manifest: %w", err)
+	}
+	defer r.Close()
+
+	m := tierManifest{}
+	err = json.NewDecoder(r).Decode(&m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tier manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m tierManifest) blobMaps(tiers map[string]objectstore.Store) ([]archivedBlobMap, error) {
+	blobMaps := []archivedBlobMap{}
+	for key, e := range m {
+		if e.Tier == "" {
+			continue
+		}
+
+		_, ok := tiers[e.Tier]
+		if !ok {
+			return nil, fmt.Errorf("blob %s is in unknown tier %q", key, e.Tier)
+		}
+
+		match := blobRegexp.FindStringSubmatch(path.Base(key))
+		if match == nil {
+			return nil, fmt.Errorf("invalid blob key %q in tier manifest", key)
+		}
+
+		from, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse blob from index %q: %w", match[1], err)
+		}
+
+		to, err := strconv.ParseUint(match[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse blob to index %q: %w", match[2], err)
+		}
+
+		blobMaps = append(blobMaps, archivedBlobMap{
+			from:    from,
+			to:      to,
+			key:     key,
+			size:    e.Size,
+			tier:    e.Tier,
+			created: e.Created,
+		})
+	}
+	return blobMaps, nil
+}
+
+// ApplyTiering moves every blob whose age matches a rule to the tier of the rule.
+// Blobs are copied and verified before the manifest is updated and the source is deleted.
+func (a *Archive) ApplyTiering(ctx context.Context, rules []TieringRule, now time.Time) error {
+	rules = slices.Clone(rules)
+	slices.SortFunc(rules, func(x, y TieringRule) int {
+		return cmp.Compare(y.MinAge, x.MinAge)
+	})
+
+	a.maintenanceLock.Lock()
+	defer a.maintenanceLock.Unlock()
+
+	err := a.deleteStaleKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.readLock.RLock()
+	blobMaps := slices.Clone(a.archivedBlobMaps)
+	a.readLock.RUnlock()
+
+	for _, bm := range blobMaps {
+		if bm.tier != "" {
+			continue
+		}
+
+		for _, r := range rules {
+			if now.Sub(bm.created) < r.MinAge {
+				continue
+			}
+
+			err := a.moveBlob(ctx, bm, r.Tier)
+			if err != nil {
+				return fmt.Errorf("failed to move blob %s to tier %s: %w", bm.key, r.Tier, err)
+			}
+			break
+		}
+	}
+
+	return a.deleteStaleKeys(ctx)
+}
+
+// Restore moves the blob holding index back from its tier to the archive store.
+func (a *Archive) Restore(ctx context.Context, index uint64) error {
+	a.maintenanceLock.Lock()
+	defer a.maintenanceLock.Unlock()
+
+	a.readLock.RLock()
+	i := slices.IndexFunc(a.archivedBlobMaps, func(bm archivedBlobMap) bool {
+		return index >= bm.from && index <= bm.to
+	})
+	var bm archivedBlobMap
+	if i >= 0 {
+		bm = a.archivedBlobMaps[i]
+	}
+	a.readLock.RUnlock()
+
+	if i < 0 {
+		return fmt.Errorf("index %d is not archived", index)
+	}
+
+	if bm.tier == "" {
+		return nil
+	}
+
+	err := a.moveBlob(ctx, bm, "")
+	if err != nil {
+		return err
+	}
+
+	return a.deleteStaleKeys(ctx)
+}
+
+// updateTierManifest stores the manifest changed by update, which must not modify the manifest
+// it is passed but return a changed copy.
+func (a *Archive) updateTierManifest(ctx context.Context, update func(m tierManifest) tierManifest) error {
+	a.appendLock.Lock()
+	defer a.appendLock.Unlock()
+
+	manifest := update(a.tierManifest)
+
+	d, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tier manifest: %w", err)
+	}
+
+	err = a.store.Put(ctx, tierManifestKey(a.name), bytes.NewReader(d))
+	if err != nil {
+		return fmt.Errorf("failed to update tier manifest: %w", err)
+	}
+
+	a.tierManifest = manifest
+	return nil
+}
+
+// moveBlob copies the blob to the store of the tier and switches reads to the copy, the source
+// becomes a stale key.
+func (a *Archive) moveBlob(ctx context.Context, bm archivedBlobMap, tier string) error {
+	src := a.storeFor(bm.tier)
+	dst := a.storeFor(tier)
+	if dst == nil {
+		return fmt.Errorf("unknown tier %q", tier)
+	}
+
+	r, err := src.Get(ctx, bm.key)
+	if err != nil {
+		return err
+	}
+
+	err = dst.Put(ctx, bm.key, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	err = verifyCopy(ctx, dst, bm)
+	if err != nil {
+		dst.Delete(ctx, bm.key)
+		return err
+	}
+
+	// a blob restored to the archive store is as old as its copy there
+	created := bm.created
+	if tier == "" {
+		created = time.Now()
+	}
+
+	err = a.updateTierManifest(ctx, func(m tierManifest) tierManifest {
+		m = maps.Clone(m)
+		if tier == "" {
+			delete(m, bm.key)
+		} else {
+			m[bm.key] = tierEntry{Tier: tier, Size: bm.size, Created: created}
+		}
+		return m
+	})
+	if err != nil {
+		dst.Delete(ctx, bm.key)
+		return err
+	}
+
+	a.readLock.Lock()
+	for i := range a.archivedBlobMaps {
+		if a.archivedBlobMaps[i].key == bm.key {
+			a.archivedBlobMaps[i].tier = tier
+			a.archivedBlobMaps[i].created = created
+		}
+	}
+	a.staleKeys = append(a.staleKeys, staleKey{tier: bm.tier, key: bm.key})
+	a.readLock.Unlock()
+
+	return nil
+}
+
+// verifyCopy reads the copy of the blob back and checks its entries and its checksum, so that
+// the source is only deleted once the copy is known to be intact.
+func verifyCopy(ctx context.Context, st objectstore.Store, bm archivedBlobMap) error {
+	r, err := st.Get(ctx, bm.key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = verifyBlobmap(bufio.NewReader(r), bm.from, bm.to)
+	if err != nil {
+		return fmt.Errorf("copy of blob %s is corrupt: %w", bm.key, err)
+	}
+
+	return nil
+}
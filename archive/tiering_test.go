@@ -0,0 +1,208 @@
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiering(t *testing.T) {
+	ctx := context.Background()
+
+	hot := objectstore.NewMemory()
+	cold := objectstore.NewMemory()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	opts := archive.OpenOptions{
+		Store:        hot,
+		Name:         "test-archive",
+		BlobmapCache: bmc,
+		WorkDir:      t.TempDir(),
+		Tiers:        map[string]objectstore.Store{"cold": cold},
+	}
+
+	log := slogt.New(t)
+	ar, err := archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+	require.NoError(t, err)
+	for i := uint64(0); i < 10; i++ {
+		require.NoError(t, sm.Append(i, []byte{byte(i)}))
+	}
+	require.NoError(t, ar.Append(ctx, sm))
+	require.NoError(t, sm.Close())
+
+	ar, err = archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+
+	readAll := func(ar *archive.Archive) []uint64 {
+		indexes := []uint64{}
+		err := ar.Read(ctx, 0, 10, func(ctx context.Context, index uint64, data []byte) error {
+			require.Equal(t, []byte{byte(index)}, data)
+			indexes = append(indexes, index)
+			return nil
+		})
+		require.NoError(t, err)
+		return indexes
+	}
+
+	blobKeys := func(st objectstore.Store) []string {
+		infos, err := st.List(ctx, "test-archive/blobs/")
+		require.NoError(t, err)
+		keys := []string{}
+		for _, o := range infos {
+			keys = append(keys, o.Key)
+		}
+		return keys
+	}
+
+	err = ar.ApplyTiering(ctx, []archive.TieringRule{{MinAge: time.Hour, Tier: "cold"}}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, blobKeys(hot), 1)
+	require.Empty(t, blobKeys(cold))
+
+	before := ar.Blobs()[0]
+
+	err = ar.ApplyTiering(ctx, []archive.TieringRule{{MinAge: 0, Tier: "cold"}}, time.Now())
+	require.NoError(t, err)
+	require.Empty(t, blobKeys(hot))
+	require.Len(t, blobKeys(cold), 1)
+	require.Len(t, readAll(ar), 10)
+
+	// the move neither makes the blob newer for tiering nor for breaking ties between overlapping blobs
+	require.Equal(t, before.LastModified, ar.Blobs()[0].LastModified)
+	require.Equal(t, before.Created, ar.Blobs()[0].Created)
+
+	ar, err = archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+	require.Len(t, readAll(ar), 10)
+
+	require.NoError(t, ar.Restore(ctx, 5))
+	require.Len(t, blobKeys(hot), 1)
+	require.Empty(t, blobKeys(cold))
+
+	ar, err = archive.Open(ctx, log, opts)
+	require.NoError(t, err)
+	require.Len(t, readAll(ar), 10)
+}
+
+// corruptingStore flips a byte in the middle of every object put into it.
+type corruptingStore struct {
+	objectstore.Store
+}
+
+func (s corruptingStore) Put(ctx context.Context, key string, r io.Reader) error {
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d[len(d)/2] ^= 0xff
+	return s.Store.Put(ctx, key, bytes.NewReader(d))
+}
+
+func TestTieringFailures(t *testing.T) {
+	ctx := context.Background()
+
+	open := func(t *testing.T, hot, cold objectstore.Store) *archive.Archive {
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+		t.Cleanup(bmc.Close)
+
+		ar, err := archive.Open(ctx, slogt.New(t), archive.OpenOptions{
+			Store:        hot,
+			Name:         "test-archive",
+			BlobmapCache: bmc,
+			WorkDir:      t.TempDir(),
+			Tiers:        map[string]objectstore.Store{"cold": cold},
+		})
+		require.NoError(t, err)
+		return ar
+	}
+
+	archiveBlobs := func(t *testing.T, hot objectstore.Store) {
+		ar := open(t, hot, objectstore.NewMemory())
+		for from := uint64(0); from < 30; from += 10 {
+			sm, err := statemate.Open[uint64](filepath.Join(t.TempDir(), "statemate"), statemate.Options{})
+			require.NoError(t, err)
+			for i := from; i < from+10; i++ {
+				require.NoError(t, sm.Append(i, []byte{byte(i)}))
+			}
+			require.NoError(t, ar.Append(ctx, sm))
+			require.NoError(t, sm.Close())
+		}
+	}
+
+	rules := []archive.TieringRule{{MinAge: 0, Tier: "cold"}}
+
+	t.Run("corrupt copy", func(t *testing.T) {
+		hot := objectstore.NewMemory()
+		archiveBlobs(t, hot)
+
+		ar := open(t, hot, corruptingStore{objectstore.NewMemory()})
+		require.ErrorContains(t, ar.ApplyTiering(ctx, rules, time.Now()), "corrupt")
+
+		infos, err := hot.List(ctx, "test-archive/blobs/")
+		require.NoError(t, err)
+		require.Len(t, infos, 3)
+		require.NoError(t, ar.Read(ctx, 0, 30, func(ctx context.Context, index uint64, data []byte) error {
+			return nil
+		}))
+	})
+
+	t.Run("read in progress", func(t *testing.T) {
+		hot := objectstore.NewMemory()
+		archiveBlobs(t, hot)
+
+		ar := open(t, hot, objectstore.NewMemory())
+
+		reading := make(chan struct{})
+		release := make(chan struct{})
+		read := make(chan error, 1)
+
+		go func() {
+			read <- ar.Read(ctx, 0, 30, func(ctx context.Context, index uint64, data []byte) error {
+				if index == 0 {
+					close(reading)
+					<-release
+				}
+				return nil
+			})
+		}()
+
+		<-reading
+
+		moved := make(chan error, 1)
+		go func() {
+			moved <- ar.ApplyTiering(ctx, rules, time.Now())
+		}()
+
+		select {
+		case err := <-moved:
+			close(release)
+			t.Fatalf("tiering deleted the blobs of a read in progress: %v, read: %v", err, <-read)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(release)
+		require.NoError(t, <-read)
+		require.NoError(t, <-moved)
+
+		infos, err := hot.List(ctx, "test-archive/blobs/")
+		require.NoError(t, err)
+		require.Empty(t, infos)
+	})
+}
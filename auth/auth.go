@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Identity of an authenticated client.
+type Identity struct {
+	Subject string
+	// Method that authenticated the client: token, hmac or cert.
+	Method string
+}
+
+var (
+	// ErrNoCredentials is returned by an Authenticator for requests without credentials it knows.
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+type chain []Authenticator
+
+// Chain tries the authenticators in order until one of them finds credentials it knows in the request.
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
+
+func (c chain) Authenticate(r *http.Request) (Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return id, err
+	}
+
+	// a bearer token none of the authenticators knows is not missing, it is wrong
+	_, ok := bearerToken(r)
+	if ok {
+		return Identity{}, fmt.Errorf("%w: unknown token", ErrInvalidCredentials)
+	}
+
+	return Identity{}, ErrNoCredentials
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the identity of the client.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity of the client in ctx, if there is one.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	a := auth.Chain(
+		auth.StaticTokens(map[string]string{"secret": "ci"}),
+		auth.HMACTokens(key),
+		auth.ClientCert(),
+	)
+
+	authenticate := func(token string) (auth.Identity, error) {
+		r := httptest.NewRequest("GET", "/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return a.Authenticate(r)
+	}
+
+	t.Run("static token", func(t *testing.T) {
+		id, err := authenticate("secret")
+		require.NoError(t, err)
+		require.Equal(t, auth.Identity{Subject: "ci", Method: "token"}, id)
+	})
+
+	t.Run("signed token", func(t *testing.T) {
+		id, err := authenticate(auth.SignToken(key, "alice", time.Now().Add(time.Hour)))
+		require.NoError(t, err)
+		require.Equal(t, auth.Identity{Subject: "alice", Method: "hmac"}, id)
+	})
+
+	t.Run("expired signed token", func(t *testing.T) {
+		_, err := authenticate(auth.SignToken(key, "alice", time.Now().Add(-time.Second)))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		require.ErrorContains(t, err, "expired")
+	})
+
+	t.Run("token signed with another key", func(t *testing.T) {
+		_, err := authenticate(auth.SignToken([]byte("another key"), "alice", time.Now().Add(time.Hour)))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("tampered signed token", func(t *testing.T) {
+		token := auth.SignToken(key, "alice", time.Now().Add(time.Hour))
+		other := auth.SignToken(key, "mallory", time.Now().Add(time.Hour))
+		_, err := authenticate(other[:len(other)-43] + token[len(token)-43:])
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := authenticate("guess")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		_, err := authenticate("")
+		require.ErrorIs(t, err, auth.ErrNoCredentials)
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ingester"}}}},
+		}
+
+		id, err := a.Authenticate(r)
+		require.NoError(t, err)
+		require.Equal(t, auth.Identity{Subject: "ingester", Method: "cert"}, id)
+	})
+
+	t.Run("unverified client certificate", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ingester"}}},
+		}
+
+		_, err := a.Authenticate(r)
+		require.ErrorIs(t, err, auth.ErrNoCredentials)
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	p := auth.Policy{Grants: []auth.Grant{
+		{Subject: "ci", Datasets: []string{"events", "logs-*"}, Permissions: []auth.Permission{auth.Read, auth.Append}},
+		{Subject: "ops", Datasets: []string{auth.AllDatasets}, Permissions: []auth.Permission{auth.Admin}},
+		{Subject: "*", Datasets: []string{"public"}, Permissions: []auth.Permission{auth.Read}},
+		{Subject: "acme-ci", Datasets: []string{"acme/*"}, Permissions: []auth.Permission{auth.Append}},
+		{Subject: "scraper", Datasets: []string{auth.Lead}, Permissions: []auth.Permission{auth.Read}},
+	}}
+	require.NoError(t, p.Validate())
+
+	for _, c := range []struct {
+		subject string
+		dataset string
+		perm    auth.Permission
+		allowed bool
+	}{
+		{"ci", "events", auth.Append, true},
+		{"ci", "logs-app", auth.Read, true},
+		{"ci", "events-2", auth.Read, false},
+		{"ci", "events", auth.Admin, false},
+		{"ci", auth.AllDatasets, auth.Read, false},
+		{"ops", "anything", auth.Append, true},
+		{"ops", auth.AllDatasets, auth.Admin, true},
+		{"anyone", "public", auth.Read, true},
+		{"anyone", "public", auth.Append, false},
+		{"acme-ci", "acme/events", auth.Append, true},
+		{"acme-ci", "acme/events/x", auth.Append, false},
+		{"acme-ci", "acmeco/events", auth.Append, false},
+		{"acme-ci", "events", auth.Append, false},
+		{"ci", "logs-acme/events", auth.Read, false},
+		{"ops", "acme/events", auth.Read, false},
+		{"ops", auth.Lead, auth.Read, false},
+		{"acme-ci", auth.Lead, auth.Read, false},
+		{"scraper", auth.Lead, auth.Read, true},
+		{"scraper", auth.Lead, auth.Admin, false},
+		{"scraper", "events", auth.Read, false},
+	} {
+		err := p.Authorize(c.subject, c.dataset, c.perm)
+		if c.allowed {
+			require.NoError(t, err, "%s %s %s", c.subject, c.perm, c.dataset)
+		} else {
+			require.ErrorIs(t, err, auth.ErrForbidden, "%s %s %s", c.subject, c.perm, c.dataset)
+		}
+	}
+
+	require.Error(t, auth.Policy{Grants: []auth.Grant{
+		{Subject: "ci", Datasets: []string{"events"}, Permissions: []auth.Permission{"write"}},
+	}}.Validate())
+
+	require.Error(t, auth.Policy{Grants: []auth.Grant{
+		{Subject: "ci", Datasets: []string{"ev*nts"}, Permissions: []auth.Permission{auth.Read}},
+	}}.Validate())
+}
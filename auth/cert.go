@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type clientCert struct{}
+
+// ClientCert authenticates clients by the common name of their TLS client certificate.
+// The server has to verify client certificates, only verified ones are accepted.
+func ClientCert() Authenticator {
+	return clientCert{}
+}
+
+func (clientCert) Authenticate(r *http.Request) (Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return Identity{}, fmt.Errorf("%w: client certificate without common name", ErrInvalidCredentials)
+	}
+
+	return Identity{Subject: cn, Method: "cert"}, nil
+}
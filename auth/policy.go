@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Permission string
+
+const (
+	Read   Permission = "read"
+	Append Permission = "append"
+	// Admin allows creating datasets and implies Read and Append.
+	Admin Permission = "admin"
+)
+
+// AllDatasets is the dataset pattern matching every dataset of the default tenant.
+const AllDatasets = "*"
+
+// Lead stands for the lead as a whole in grants, whose status and metrics cover the datasets of
+// all tenants. It is not a dataset name and no other pattern matches it, so it is only granted
+// explicitly.
+const Lead = "/"
+
+// Grant gives a subject permissions on datasets. Datasets are names, or prefixes of names when
+// they end with *. Datasets of tenants are named tenant/dataset and prefixes don't match across
+// the /, so only patterns like acme/* grant on the datasets of the tenant acme.
+// The subject * grants the permissions to every authenticated client.
+type Grant struct {
+	Subject     string
+	Datasets    []string
+	Permissions []Permission
+}
+
+// Policy authorizes requests of authenticated clients, anything not granted is denied.
+type Policy struct {
+	Grants []Grant
+}
+
+func (p Policy) Validate() error {
+	for i, g := range p.Grants {
+		if g.Subject == "" {
+			return fmt.Errorf("grant %d has no subject", i)
+		}
+
+		if len(g.Datasets) == 0 {
+			return fmt.Errorf("grant %d has no datasets", i)
+		}
+
+		for _, d := range g.Datasets {
+			if d == "" || strings.Contains(strings.TrimSuffix(d, "*"), "*") {
+				return fmt.Errorf("grant %d has invalid dataset pattern %q", i, d)
+			}
+		}
+
+		if len(g.Permissions) == 0 {
+			return fmt.Errorf("grant %d has no permissions", i)
+		}
+
+		for _, perm := range g.Permissions {
+			switch perm {
+			case Read, Append, Admin:
+			default:
+				return fmt.Errorf("grant %d has unknown permission %q", i, perm)
+			}
+		}
+	}
+
+	return nil
+}
+
+var ErrForbidden = errors.New("forbidden")
+
+// Authorize returns ErrForbidden unless the subject is granted perm on the dataset.
+func (p Policy) Authorize(subject, dataset string, perm Permission) error {
+	for _, g := range p.Grants {
+		if g.Subject != subject && g.Subject != "*" {
+			continue
+		}
+
+		if !grants(g.Permissions, perm) {
+			continue
+		}
+
+		for _, d := range g.Datasets {
+			if matches(d, dataset) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s has no %s permission on %s", ErrForbidden, subject, perm, dataset)
+}
+
+func grants(permissions []Permission, perm Permission) bool {
+	for _, p := range permissions {
+		if p == perm || p == Admin {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(pattern, dataset string) bool {
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	if ok {
+		rest, ok := strings.CutPrefix(dataset, prefix)
+		return ok && !strings.Contains(rest, "/")
+	}
+	return pattern == dataset
+}
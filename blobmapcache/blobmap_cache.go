@@ -2,21 +2,40 @@ package blobmapcache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/draganm/blobmap"
 	"github.com/draganm/linear/lru"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/draganm/linear/blobmapcache")
+
+// BlobmapCache keeps downloaded blobmaps in a local directory. It is a prometheus.Collector.
 type BlobmapCache struct {
 	cacheDir string
 	cache    *lru.Cache[*syncedBlobmap]
+	metrics  metrics
+	// closed is canceled by Close, stopping the loads in progress
+	closed      context.Context
+	cancelClose context.CancelFunc
+	// loadsMu orders starting loads with Close waiting for them
+	loadsMu   sync.Mutex
+	loads     sync.WaitGroup
+	closeOnce sync.Once
 }
 
+var ErrClosed = errors.New("blobmap cache is closed")
+
 type syncedBlobmap struct {
 	blobmap *blobmap.Reader
 	evicted bool
@@ -24,9 +43,12 @@ type syncedBlobmap struct {
 }
 
 func Open(cacheDir string, maxCacheSize uint64) (*BlobmapCache, error) {
+	m := newMetrics()
 	cache := &BlobmapCache{
 		cacheDir: cacheDir,
+		metrics:  m,
 		cache: lru.NewCache[*syncedBlobmap](maxCacheSize, func(key string, b *syncedBlobmap) {
+			m.evictions.Inc()
 			b.mu.Lock()
 			b.evicted = true
 			b.blobmap.Close()
@@ -34,6 +56,7 @@ func Open(cacheDir string, maxCacheSize uint64) (*BlobmapCache, error) {
 			os.Remove(filepath.Join(cacheDir, key))
 		}),
 	}
+	cache.closed, cache.cancelClose = context.WithCancel(context.Background())
 
 	// Load existing blobs from cache directory
 	entries, err := os.ReadDir(cacheDir)
@@ -72,21 +95,34 @@ func Open(cacheDir string, maxCacheSize uint64) (*BlobmapCache, error) {
 	return cache, nil
 }
 
+// WithBlobmap calls fn with the cached blobmap of the key, loading it with loadBlobMap on a miss.
 func (c *BlobmapCache) WithBlobmap(
 	ctx context.Context,
 	key string,
 	loadBlobMap func(ctx context.Context, path string) error,
 	fn func(ctx context.Context, b *blobmap.Reader) error,
-) error {
+) (err error) {
+	ctx, span := tracer.Start(ctx, "blobmapcache.WithBlobmap", trace.WithAttributes(attribute.String("linear.key", key)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	var b *syncedBlobmap
 	escapedKey := url.PathEscape(key)
 	for {
-		var err error
+		loaded := false
 		b, err = c.cache.Get(
 			key,
 			func() (*syncedBlobmap, uint64, error) {
+				loaded = true
 				blobmapPath := filepath.Join(c.cacheDir, escapedKey)
-				err := loadBlobMap(ctx, blobmapPath)
+				start := time.Now()
+				err := c.load(ctx, blobmapPath, loadBlobMap)
+				c.metrics.loadDuration.Observe(time.Since(start).Seconds())
 				if err != nil {
 					return nil, 0, fmt.Errorf("could not load blobmap %s: %w", escapedKey, err)
 				}
@@ -105,9 +141,17 @@ func (c *BlobmapCache) WithBlobmap(
 		)
 
 		if err != nil {
+			c.metrics.loadErrors.Inc()
 			return fmt.Errorf("could not get blobmap %s: %w", escapedKey, err)
 		}
 
+		if loaded {
+			c.metrics.misses.Inc()
+		} else {
+			c.metrics.hits.Inc()
+		}
+		span.SetAttributes(attribute.Bool("linear.cache_hit", !loaded))
+
 		b.mu.RLock()
 		if b.evicted {
 			b.mu.RUnlock()
@@ -123,12 +167,62 @@ func (c *BlobmapCache) WithBlobmap(
 
 }
 
+// load runs loadBlobMap unless the cache is closed, canceling it when the cache is closed.
+// Partially loaded files are removed.
+func (c *BlobmapCache) load(
+	ctx context.Context,
+	path string,
+	loadBlobMap func(ctx context.Context, path string) error,
+) error {
+	c.loadsMu.Lock()
+	if c.closed.Err() != nil {
+		c.loadsMu.Unlock()
+		return ErrClosed
+	}
+	c.loads.Add(1)
+	c.loadsMu.Unlock()
+	defer c.loads.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.closed, cancel)
+	defer stop()
+
+	ctx, span := tracer.Start(ctx, "blobmapcache.load")
+	defer span.End()
+
+	err := loadBlobMap(ctx, path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+func (c *BlobmapCache) Has(key string) bool {
+	return c.cache.Has(key)
+}
+
+func (c *BlobmapCache) MaxSize() uint64 {
+	return c.cache.MaxSize()
+}
+
+// Close cancels the loads in progress, waits for them to stop and closes the cached blobmaps,
+// which are kept in the cache directory for the next Open. Closing again does nothing.
 func (c *BlobmapCache) Close() {
-	c.cache.Close(func(s string, sb *syncedBlobmap) error {
-		sb.mu.Lock()
-		sb.blobmap.Close()
-		sb.evicted = true
-		sb.mu.Unlock()
-		return nil
+	c.closeOnce.Do(func() {
+		c.loadsMu.Lock()
+		c.cancelClose()
+		c.loadsMu.Unlock()
+		c.loads.Wait()
+
+		c.cache.Close(func(s string, sb *syncedBlobmap) error {
+			sb.mu.Lock()
+			sb.blobmap.Close()
+			sb.evicted = true
+			sb.mu.Unlock()
+			return nil
+		})
 	})
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/draganm/blobmap"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -88,4 +90,16 @@ func TestBlobmapCache(t *testing.T) {
 	// Verify first entry was evicted
 	_, err = os.Stat(filepath.Join(tempDir, testKey))
 	require.True(t, os.IsNotExist(err), "first entry should have been evicted")
+
+	require.Equal(t, 1.0, testutil.ToFloat64(cache.metrics.hits))
+	require.Equal(t, 2.0, testutil.ToFloat64(cache.metrics.misses))
+	require.Equal(t, 1.0, testutil.ToFloat64(cache.metrics.evictions))
+	require.NoError(t, testutil.CollectAndCompare(cache, strings.NewReader(`
+# HELP linear_blobmap_cache_bytes Size of the blobmaps in the cache.
+# TYPE linear_blobmap_cache_bytes gauge
+linear_blobmap_cache_bytes 2048
+# HELP linear_blobmap_cache_max_bytes Size limit of the cache.
+# TYPE linear_blobmap_cache_max_bytes gauge
+linear_blobmap_cache_max_bytes 2048
+`), "linear_blobmap_cache_bytes", "linear_blobmap_cache_max_bytes"))
 }
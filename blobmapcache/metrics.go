@@ -0,0 +1,64 @@
+package blobmapcache
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type metrics struct {
+	hits         prometheus.Counter
+	misses       prometheus.Counter
+	evictions    prometheus.Counter
+	loadErrors   prometheus.Counter
+	loadDuration prometheus.Histogram
+	bytes        *prometheus.Desc
+	maxBytes     *prometheus.Desc
+}
+
+func newMetrics() metrics {
+	return metrics{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "linear_blobmap_cache_hits_total",
+			Help: "Blobmap reads served from the cache.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "linear_blobmap_cache_misses_total",
+			Help: "Blobmap reads that loaded the blobmap into the cache.",
+		}),
+		evictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "linear_blobmap_cache_evictions_total",
+			Help: "Blobmaps evicted from the cache to make space.",
+		}),
+		loadErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "linear_blobmap_cache_load_errors_total",
+			Help: "Blobmaps that failed to load into the cache.",
+		}),
+		loadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "linear_blobmap_cache_load_duration_seconds",
+			Help:    "Duration of loading blobmaps into the cache.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+		}),
+		bytes: prometheus.NewDesc(
+			"linear_blobmap_cache_bytes",
+			"Size of the blobmaps in the cache.",
+			nil, nil,
+		),
+		maxBytes: prometheus.NewDesc(
+			"linear_blobmap_cache_max_bytes",
+			"Size limit of the cache.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *BlobmapCache) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *BlobmapCache) Collect(ch chan<- prometheus.Metric) {
+	m := c.metrics
+	m.hits.Collect(ch)
+	m.misses.Collect(ch)
+	m.evictions.Collect(ch)
+	m.loadErrors.Collect(ch)
+	m.loadDuration.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(m.bytes, prometheus.GaugeValue, float64(c.cache.Size()))
+	ch <- prometheus.MustNewConstMetric(m.maxBytes, prometheus.GaugeValue, float64(c.cache.MaxSize()))
+}
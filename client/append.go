@@ -0,0 +1,36 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Append appends data at index, which must follow the last index of the dataset.
+func (c *Client) Append(ctx context.Context, name string, index uint64, data []byte) error {
+	res, err := c.do(ctx, http.MethodPut, c.datasetURL(name, strconv.FormatUint(index, 10)), bytes.NewReader(data), http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// AppendMulti appends entries with consecutive indexes in a single request.
+func (c *Client) AppendMulti(ctx context.Context, name string, entries []Entry) error {
+	buf := &bytes.Buffer{}
+	for _, e := range entries {
+		err := WriteEntry(buf, e.Index, e.Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := c.do(ctx, http.MethodPost, c.datasetURL(name), buf, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client talks to the dataset API of a lead.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	tenant     string
+}
+
+// New creates a client of the lead at baseURL, httpClient defaults to http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// SetToken authenticates the requests of the client with the bearer token.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetTenant makes the client use the datasets of the tenant instead of the ones of the default tenant.
+func (c *Client) SetTenant(tenant string) {
+	c.tenant = tenant
+}
+
+var ErrNotFound = errors.New("not found")
+
+// StatusError is returned for responses with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) datasetsURL() string {
+	if c.tenant == "" {
+		return c.baseURL + "/api/datasets"
+	}
+	return c.baseURL + "/api/tenants/" + url.PathEscape(c.tenant) + "/datasets"
+}
+
+func (c *Client) datasetURL(name string, elems ...string) string {
+	u := c.datasetsURL() + "/" + url.PathEscape(name)
+	for _, e := range elems {
+		u += "/" + url.PathEscape(e)
+	}
+	return u
+}
+
+// do sends the request and returns the response if its status is one of expected.
+func (c *Client) do(ctx context.Context, method, u string, body io.Reader, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	for _, s := range expected {
+		if res.StatusCode == s {
+			return res, nil
+		}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	return nil, &StatusError{
+		StatusCode: res.StatusCode,
+		Message:    strings.TrimSpace(string(msg)),
+	}
+}
@@ -0,0 +1,122 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/client"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+		ArchiveDir: t.TempDir(),
+		StateDir:   t.TempDir(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ld.Close() })
+
+	s := httptest.NewServer(ld)
+	t.Cleanup(s.Close)
+
+	c := client.New(s.URL, nil)
+
+	err = c.CreateDataset(ctx, "events", dataset.DatasetConfig{MaxArchiveSize: 200, MaxArchiveTime: time.Hour})
+	require.NoError(t, err)
+
+	err = c.CreateDataset(ctx, "events", dataset.DatasetConfig{})
+	require.ErrorIs(t, err, client.ErrAlreadyExists)
+
+	names, err := c.ListDatasets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"events"}, names)
+
+	_, err = c.GetInfo(ctx, "missing")
+	require.ErrorIs(t, err, client.ErrNotFound)
+
+	err = c.Append(ctx, "events", 0, []byte("entry-000"))
+	require.NoError(t, err)
+
+	err = c.Append(ctx, "events", 5, []byte("gap"))
+	var se *client.StatusError
+	require.ErrorAs(t, err, &se)
+
+	entries := []client.Entry{}
+	for i := uint64(1); i < 50; i++ {
+		entries = append(entries, client.Entry{Index: i, Data: []byte(fmt.Sprintf("entry-%03d", i))})
+	}
+
+	err = c.AppendMulti(ctx, "events", entries)
+	require.NoError(t, err)
+
+	info, err := c.GetInfo(ctx, "events")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), info.FirstIndex)
+	require.Equal(t, uint64(49), info.LastIndex)
+
+	data, err := c.Get(ctx, "events", 7)
+	require.NoError(t, err)
+	require.Equal(t, []byte("entry-007"), data)
+
+	_, err = c.Get(ctx, "events", 50)
+	require.ErrorIs(t, err, client.ErrNotFound)
+
+	t.Run("batch", func(t *testing.T) {
+		read := []uint64{}
+		b, err := c.ReadBatch(ctx, "events", 10, 100, client.BatchOptions{MaxBytes: 3 * 25}, func(index uint64, data []byte) error {
+			read = append(read, index)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []uint64{10, 11, 12}, read)
+		require.Equal(t, client.Batch{Next: 13, HasNext: true, LastIndex: 49}, b)
+	})
+
+	t.Run("range pages until the last index", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := c.Range(ctx, "events", 45, 1000, client.BatchOptions{MaxBytes: 2 * 25}, func(index uint64, data []byte) error {
+			return client.WriteEntry(buf, index, data)
+		})
+		require.NoError(t, err)
+
+		read := []string{}
+		err = client.ReadEntries(buf, func(index uint64, data []byte) error {
+			read = append(read, fmt.Sprintf("%d:%s", index, data))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"45:entry-045", "46:entry-046", "47:entry-047", "48:entry-048", "49:entry-049"}, read)
+	})
+
+	t.Run("range over the whole index space", func(t *testing.T) {
+		n := 0
+		err := c.Range(ctx, "events", 0, math.MaxUint64, client.BatchOptions{}, func(index uint64, data []byte) error {
+			n++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 50, n)
+	})
+}
+
+func TestReadEntriesRejectsHugeEntries(t *testing.T) {
+	var frame [16]byte
+	binary.BigEndian.PutUint64(frame[:8], 1)
+	binary.BigEndian.PutUint64(frame[8:], math.MaxUint64)
+
+	err := client.ReadEntries(bytes.NewReader(frame[:]), func(index uint64, data []byte) error {
+		return nil
+	})
+	require.ErrorContains(t, err, "larger than the maximum")
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/draganm/linear/dataset"
+)
+
+var ErrAlreadyExists = errors.New("dataset already exists")
+
+// ListDatasets returns the sorted names of the datasets.
+func (c *Client) ListDatasets(ctx context.Context) ([]string, error) {
+	res, err := c.do(ctx, http.MethodGet, c.datasetsURL(), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	names := []string{}
+	err = json.NewDecoder(res.Body).Decode(&names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dataset names: %w", err)
+	}
+
+	return names, nil
+}
+
+// CreateDataset creates a dataset, failing with ErrAlreadyExists if it exists.
+func (c *Client) CreateDataset(ctx context.Context, name string, config dataset.DatasetConfig) error {
+	d, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dataset config: %w", err)
+	}
+
+	res, err := c.do(ctx, http.MethodPut, c.datasetURL(name), bytes.NewReader(d), http.StatusCreated)
+
+	var se *StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusConflict {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// GetInfo returns the config and the bounds of a dataset.
+// FirstIndex and LastIndex are math.MaxUint64 when the dataset is empty.
+func (c *Client) GetInfo(ctx context.Context, name string) (dataset.DatasetInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, c.datasetURL(name), nil, http.StatusOK)
+	if err != nil {
+		return dataset.DatasetInfo{}, err
+	}
+	defer res.Body.Close()
+
+	var info dataset.DatasetInfo
+	err = json.NewDecoder(res.Body).Decode(&info)
+	if err != nil {
+		return dataset.DatasetInfo{}, fmt.Errorf("failed to decode dataset info: %w", err)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxEntrySize is the largest entry ReadEntries accepts, so that a corrupt stream can't make it
+// allocate arbitrary amounts of memory.
+const MaxEntrySize = 64 * 1024 * 1024
+
+// Entry is a single entry of a dataset.
+type Entry struct {
+	Index uint64
+	Data  []byte
+}
+
+// WriteEntry writes an entry in the framing of batch responses and multi appends:
+// big endian index, big endian size and data.
+func WriteEntry(w io.Writer, index uint64, data []byte) error {
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[:8], index)
+	binary.BigEndian.PutUint64(header[8:], uint64(len(data)))
+
+	_, err := w.Write(header[:])
+	if err != nil {
+		return fmt.Errorf("failed to write entry header: %w", err)
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write entry data: %w", err)
+	}
+
+	return nil
+}
+
+// ReadEntries calls fn for every framed entry read from r until EOF.
+// The data passed to fn is only valid until fn returns.
+func ReadEntries(r io.Reader, fn func(index uint64, data []byte) error) error {
+	var header [16]byte
+	buf := []byte{}
+
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read entry header: %w", err)
+		}
+
+		index := binary.BigEndian.Uint64(header[:8])
+		size := binary.BigEndian.Uint64(header[8:])
+
+		if size > MaxEntrySize {
+			return fmt.Errorf("entry %d has size %d, larger than the maximum of %d", index, size, MaxEntrySize)
+		}
+
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return fmt.Errorf("failed to read data of entry %d: %w", index, err)
+		}
+
+		err = fn(index, buf)
+		if err != nil {
+			return err
+		}
+	}
+}
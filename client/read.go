@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/draganm/linear/dataset"
+)
+
+// Get returns the data of the entry at index.
+func (c *Client) Get(ctx context.Context, name string, index uint64) ([]byte, error) {
+	res, err := c.do(ctx, http.MethodGet, c.datasetURL(name, strconv.FormatUint(index, 10)), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entry: %w", err)
+	}
+
+	return data, nil
+}
+
+type BatchOptions struct {
+	// MaxBytes limits the framed size of the batch, the server limit applies when zero.
+	MaxBytes uint64
+	// Descending reads from the index downwards.
+	Descending bool
+	// Filter holds the query parameters of a filter, see the filter package.
+	Filter url.Values
+}
+
+// Batch describes a batch response once its entries are read.
+type Batch struct {
+	// Next is the index to continue from, valid if HasNext is set.
+	Next    uint64
+	HasNext bool
+	// LastIndex of the dataset when the batch was started.
+	LastIndex uint64
+}
+
+// ReadBatch calls fn for up to count entries starting at from. Servers limit the size of a batch,
+// reading continues from Batch.Next.
+func (c *Client) ReadBatch(
+	ctx context.Context,
+	name string,
+	from, count uint64,
+	opts BatchOptions,
+	fn func(index uint64, data []byte) error,
+) (Batch, error) {
+	q := url.Values{}
+	for k, v := range opts.Filter {
+		q[k] = v
+	}
+
+	if opts.MaxBytes > 0 {
+		q.Set("maxBytes", strconv.FormatUint(opts.MaxBytes, 10))
+	}
+
+	if opts.Descending {
+		q.Set("order", "desc")
+	}
+
+	u := c.datasetURL(name, strconv.FormatUint(from, 10), strconv.FormatUint(count, 10))
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	res, err := c.do(ctx, http.MethodGet, u, nil, http.StatusOK)
+	if err != nil {
+		return Batch{}, err
+	}
+	defer res.Body.Close()
+
+	b := Batch{}
+
+	b.LastIndex, err = strconv.ParseUint(res.Header.Get(dataset.LastIndexHeader), 10, 64)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to parse %s header: %w", dataset.LastIndexHeader, err)
+	}
+
+	err = ReadEntries(res.Body, fn)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	next := res.Trailer.Get(dataset.NextIndexTrailer)
+	if next != "" {
+		b.Next, err = strconv.ParseUint(next, 10, 64)
+		if err != nil {
+			return Batch{}, fmt.Errorf("failed to parse %s trailer: %w", dataset.NextIndexTrailer, err)
+		}
+		b.HasNext = true
+	}
+
+	return b, nil
+}
+
+// Range calls fn for the entries in [from, to] in ascending order, stopping early at the last index of the dataset.
+func (c *Client) Range(
+	ctx context.Context,
+	name string,
+	from, to uint64,
+	opts BatchOptions,
+	fn func(index uint64, data []byte) error,
+) error {
+	opts.Descending = false
+
+	for from <= to {
+		// the count of the whole index space does not fit an uint64, the server caps it anyway
+		count := max(to-from+1, to-from)
+
+		b, err := c.ReadBatch(ctx, name, from, count, opts, fn)
+		if err != nil {
+			return err
+		}
+
+		if !b.HasNext || b.Next > to || b.Next > b.LastIndex || b.Next <= from {
+			return nil
+		}
+
+		from = b.Next
+	}
+
+	return nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/lead"
+	"github.com/draganm/linear/objectstore"
+	"github.com/draganm/statemate"
+)
+
+const archiveUsage = `usage: linear archive <command> [flags] <dataset> ...
+
+Inspects the archive of a dataset straight from the store, without a running lead.
+Datasets of tenants are named <tenant>/<dataset>.
+
+commands:
+  ls       list the archived blobs
+  dump     print the archived entries of an index range
+  verify   check the layout and the checksums of all archived blobs
+  diff     compare a head file of a lead with the archive
+`
+
+func archiveCommand(ctx context.Context, args []string) error {
+	commands := map[string]func(context.Context, []string) error{
+		"ls":     archiveLsCommand,
+		"dump":   archiveDumpCommand,
+		"verify": archiveVerifyCommand,
+		"diff":   archiveDiffCommand,
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, archiveUsage)
+		return flag.ErrHelp
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown archive command %q\n\n%s", args[0], archiveUsage)
+	}
+
+	return cmd(ctx, args[1:])
+}
+
+// storeSettings are the settings of the server config used to access the store.
+func storeSettings() []setting {
+	st := []setting{}
+	for _, s := range settings {
+		if s.name == "archive-dir" || s.name == "cache-size" || s.name == "log-level" || strings.HasPrefix(s.name, "s3-") {
+			st = append(st, s)
+		}
+	}
+	return st
+}
+
+// inspectCommand holds the flags shared by the archive commands.
+type inspectCommand struct {
+	fs   *flag.FlagSet
+	load func() (serveConfig, error)
+}
+
+func newInspectCommand(name, args string) *inspectCommand {
+	fs := flag.NewFlagSet("archive "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: linear archive %s [flags] %s\n\nThe store is configured like for serve.\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	return &inspectCommand{
+		fs:   fs,
+		load: configFlags(fs, storeSettings(), os.LookupEnv),
+	}
+}
+
+// openArchive opens the archive of a dataset with a blobmap cache in a temporary directory.
+// close releases the archive and removes the directory.
+func (ic *inspectCommand) openArchive(ctx context.Context, name string) (ar *archive.Archive, close func(), err error) {
+	cfg, err := ic.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.ArchiveDir == "" && cfg.S3.Bucket == "" {
+		return nil, nil, errors.New("either the archive dir or the S3 bucket must be set")
+	}
+
+	store, err := lead.NewStore(ctx, cfg.leadConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := store.Get(ctx, path.Join(name, "dataset.json"))
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return nil, nil, fmt.Errorf("dataset %s not found", name)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get dataset config: %w", err)
+	}
+	r.Close()
+
+	tmp, err := os.MkdirTemp("", "linear-archive-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	cacheSize := cfg.CacheSize
+	if cacheSize == 0 {
+		cacheSize = lead.DefaultCacheSize
+	}
+
+	cache, err := blobmapcache.Open(filepath.Join(tmp, "cache"), cacheSize)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, nil, fmt.Errorf("failed to open blobmap cache: %w", err)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}))
+
+	ar, err = archive.Open(ctx, log, archive.OpenOptions{
+		Store:        store,
+		Name:         name,
+		BlobmapCache: cache,
+		WorkDir:      tmp,
+	})
+	if err != nil {
+		cache.Close()
+		os.RemoveAll(tmp)
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	return ar, func() {
+		ar.Close()
+		cache.Close()
+		os.RemoveAll(tmp)
+	}, nil
+}
+
+// resolveArchiveIndex parses an index, which can be first or last to refer to the bounds of the archive.
+func resolveArchiveIndex(ar *archive.Archive, s string) (uint64, error) {
+	if s != "first" && s != "last" {
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid index %q", s)
+		}
+		return i, nil
+	}
+
+	first, last, ok := ar.Bounds()
+	if !ok {
+		return 0, errors.New("archive is empty")
+	}
+
+	if s == "first" {
+		return first, nil
+	}
+
+	return last, nil
+}
+
+func archiveLsCommand(ctx context.Context, args []string) error {
+	ic := newInspectCommand("ls", "<dataset>")
+	positional, err := parseArgs(ic.fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	ar, close, err := ic.openArchive(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tENTRIES\tSIZE\tTIER\tMODIFIED\tKEY INDEX\tKEY")
+
+	var entries, size uint64
+	blobs := ar.Blobs()
+
+	for _, b := range blobs {
+		tier := b.Tier
+		if tier == "" {
+			tier = "-"
+		}
+
+		keyIndex := "no"
+		if b.KeyIndexKey != "" {
+			keyIndex = "yes"
+		}
+
+		modified := "-"
+		if !b.LastModified.IsZero() {
+			modified = b.LastModified.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", b.From, b.To, b.To-b.From+1, b.Size, tier, modified, keyIndex, b.Key)
+
+		entries += b.To - b.From + 1
+		size += b.Size
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d blobs, %d entries, %d bytes\n", len(blobs), entries, size)
+
+	return nil
+}
+
+func archiveDumpCommand(ctx context.Context, args []string) error {
+	ic := newInspectCommand("dump", "<dataset> <from|first> [to|last]")
+	format := formatHex
+	ic.fs.Var(&format, "format", "output format: hex, raw or json")
+
+	positional, err := parseArgs(ic.fs, args, 2, 3)
+	if err != nil {
+		return err
+	}
+
+	ar, close, err := ic.openArchive(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	from, err := resolveArchiveIndex(ar, positional[1])
+	if err != nil {
+		return err
+	}
+
+	to := from
+	if len(positional) == 3 {
+		to, err = resolveArchiveIndex(ar, positional[2])
+		if err != nil {
+			return err
+		}
+	}
+
+	if to < from {
+		return fmt.Errorf("invalid range %d-%d", from, to)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	err = ar.Read(ctx, from, to-from+1, func(ctx context.Context, index uint64, data []byte) error {
+		return format.writeEntry(w, index, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	return nil
+}
+
+func archiveVerifyCommand(ctx context.Context, args []string) error {
+	ic := newInspectCommand("verify", "<dataset>")
+	positional, err := parseArgs(ic.fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	ar, close, err := ic.openArchive(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	problems := 0
+
+	blobs := ar.Blobs()
+	for i, b := range blobs {
+		if i > 0 && blobs[i-1].To+1 < b.From {
+			fmt.Printf("GAP     indexes %d-%d are not archived\n", blobs[i-1].To+1, b.From-1)
+			problems++
+		}
+
+		err = ar.VerifyBlob(ctx, b)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			fmt.Printf("FAILED  %s: %v\n", b.Key, err)
+			problems++
+			continue
+		}
+
+		fmt.Printf("OK      %s\n", b.Key)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problems found in %d blobs", problems, len(blobs))
+	}
+
+	fmt.Printf("%d blobs verified\n", len(blobs))
+
+	return nil
+}
+
+func archiveDiffCommand(ctx context.Context, args []string) error {
+	ic := newInspectCommand("diff", "<dataset> <head file>")
+	maxReported := ic.fs.Int("max-reported", 20, "number of differing indexes to print")
+
+	positional, err := parseArgs(ic.fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	ar, close, err := ic.openArchive(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	head, closeHead, err := openHeadCopy(positional[1])
+	if err != nil {
+		return err
+	}
+	defer closeHead()
+
+	if head.IsEmpty() {
+		fmt.Println("head is empty")
+		return nil
+	}
+
+	headFirst, headLast := head.GetFirstIndex(), head.GetLastIndex()
+	fmt.Printf("head:     %d-%d (%d entries)\n", headFirst, headLast, headLast-headFirst+1)
+
+	archiveFirst, archiveLast, archived := ar.Bounds()
+	if !archived {
+		fmt.Println("archive:  empty")
+		return nil
+	}
+	fmt.Printf("archive:  %d-%d\n", archiveFirst, archiveLast)
+
+	if headLast < archiveFirst || headFirst > archiveLast {
+		fmt.Println("head and archive do not overlap")
+		return nil
+	}
+
+	lo, hi := max(headFirst, archiveFirst), min(headLast, archiveLast)
+
+	var compared, missing uint64
+	differing := []uint64{}
+
+	// walk the blobs instead of reading the whole overlap, which fails on gaps in the archive
+	next := lo
+	for _, b := range ar.Blobs() {
+		if b.To < next || b.From > hi {
+			continue
+		}
+
+		from, to := max(next, b.From), min(b.To, hi)
+		missing += from - next
+
+		err = ar.Read(ctx, from, to-from+1, func(ctx context.Context, index uint64, data []byte) error {
+			compared++
+			return head.Read(index, func(headData []byte) error {
+				if !bytes.Equal(data, headData) {
+					differing = append(differing, index)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to compare indexes %d-%d: %w", from, to, err)
+		}
+
+		next = to + 1
+		if to == hi {
+			break
+		}
+	}
+
+	if next <= hi {
+		missing += hi - next + 1
+	}
+
+	fmt.Printf("compared: %d entries, %d differing\n", compared, len(differing))
+
+	if missing > 0 {
+		fmt.Printf("missing:  %d entries of the overlap are not archived\n", missing)
+	}
+
+	if headLast > archiveLast {
+		fmt.Printf("pending:  %d-%d are in the head only\n", max(archiveLast+1, headFirst), headLast)
+	}
+
+	for i, index := range differing {
+		if i == *maxReported {
+			fmt.Printf("... and %d more\n", len(differing)-i)
+			break
+		}
+		fmt.Printf("differs:  %d\n", index)
+	}
+
+	if len(differing) > 0 {
+		return fmt.Errorf("%d entries differ", len(differing))
+	}
+
+	return nil
+}
+
+// openHeadCopy opens a copy of a head statemate, so that the files of a lead are never modified.
+func openHeadCopy(fileName string) (*statemate.StateMate[uint64], func(), error) {
+	tmp, err := os.MkdirTemp("", "linear-head-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	copyFile := func(src, dst string) error {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(out, in)
+		return errors.Join(err, out.Close())
+	}
+
+	copied := filepath.Join(tmp, "head")
+	err = errors.Join(copyFile(fileName, copied), copyFile(fileName+".idx", copied+".idx"))
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, nil, fmt.Errorf("failed to copy head: %w", err)
+	}
+
+	sm, err := statemate.Open[uint64](copied, statemate.Options{})
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, nil, fmt.Errorf("failed to open head: %w", err)
+	}
+
+	return sm, func() {
+		sm.Close()
+		os.RemoveAll(tmp)
+	}, nil
+}
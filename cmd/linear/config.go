@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/lead"
+	"gopkg.in/yaml.v3"
+)
+
+type serveConfig struct {
+	Listen          string        `yaml:"listen" toml:"listen"`
+	LogLevel        slog.Level    `yaml:"log_level" toml:"log_level"`
+	StateDir        string        `yaml:"state_dir" toml:"state_dir"`
+	ArchiveDir      string        `yaml:"archive_dir" toml:"archive_dir"`
+	ReadOnly        bool          `yaml:"read_only" toml:"read_only"`
+	RefreshInterval time.Duration `yaml:"refresh_interval" toml:"refresh_interval"`
+	CacheSize       uint64        `yaml:"cache_size" toml:"cache_size"`
+	// ArchiveLagBudget is how long archiving can be overdue before the lead reports not ready.
+	ArchiveLagBudget      time.Duration      `yaml:"archive_lag_budget" toml:"archive_lag_budget"`
+	ArchiveHeadOnShutdown bool               `yaml:"archive_head_on_shutdown" toml:"archive_head_on_shutdown"`
+	S3                    s3Config           `yaml:"s3" toml:"s3"`
+	TLS                   tlsConfig          `yaml:"tls" toml:"tls"`
+	Auth                  authConfig         `yaml:"auth" toml:"auth"`
+	AppendLimits          appendLimitsConfig `yaml:"append_limits" toml:"append_limits"`
+	// Tenants and their quotas, the datasets outside of tenants belong to the default tenant.
+	Tenants  map[string]quotaConfig `yaml:"tenants" toml:"tenants"`
+	Timeouts timeouts               `yaml:"timeouts" toml:"timeouts"`
+	// Tiers are the stores named by the tiering rules of datasets.
+	Tiers               map[string]tierConfig `yaml:"tiers" toml:"tiers"`
+	MaintenanceInterval time.Duration         `yaml:"maintenance_interval" toml:"maintenance_interval"`
+}
+
+type s3Config struct {
+	Endpoint         string `yaml:"endpoint" toml:"endpoint"`
+	Region           string `yaml:"region" toml:"region"`
+	Bucket           string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID      string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey  string `yaml:"secret_access_key" toml:"secret_access_key"`
+	VirtualHostStyle bool   `yaml:"virtual_host_style" toml:"virtual_host_style"`
+	DisableHTTPS     bool   `yaml:"disable_https" toml:"disable_https"`
+	StorageClass     string `yaml:"storage_class" toml:"storage_class"`
+}
+
+type tlsConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	// ClientCAFile verifies client certificates, which then authenticate clients by their common name.
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+}
+
+// authConfig enables authentication when tokens, an HMAC key or a client CA are configured.
+type authConfig struct {
+	Tokens []tokenConfig `yaml:"tokens" toml:"tokens"`
+	// HMACKeyFile holds the key of the tokens signed by linear token.
+	HMACKeyFile string        `yaml:"hmac_key_file" toml:"hmac_key_file"`
+	Grants      []grantConfig `yaml:"grants" toml:"grants"`
+}
+
+type tokenConfig struct {
+	Token   string `yaml:"token" toml:"token"`
+	Subject string `yaml:"subject" toml:"subject"`
+}
+
+type grantConfig struct {
+	Subject     string   `yaml:"subject" toml:"subject"`
+	Datasets    []string `yaml:"datasets" toml:"datasets"`
+	Permissions []string `yaml:"permissions" toml:"permissions"`
+}
+
+// appendLimitsConfig rate limits appends, zero rates are unlimited, and rejects them once the head
+// of a dataset is past a high-water mark, zero disables a mark.
+type appendLimitsConfig struct {
+	DatasetRate          float64 `yaml:"dataset_rate" toml:"dataset_rate"`
+	DatasetBurst         int     `yaml:"dataset_burst" toml:"dataset_burst"`
+	ClientRate           float64 `yaml:"client_rate" toml:"client_rate"`
+	ClientBurst          int     `yaml:"client_burst" toml:"client_burst"`
+	MaxHeadBytes         uint64  `yaml:"max_head_bytes" toml:"max_head_bytes"`
+	MaxUnarchivedEntries uint64  `yaml:"max_unarchived_entries" toml:"max_unarchived_entries"`
+}
+
+// quotaConfig limits the storage of a tenant, zero values are unlimited.
+type quotaConfig struct {
+	MaxDatasets      int    `yaml:"max_datasets" toml:"max_datasets"`
+	MaxArchivedBytes uint64 `yaml:"max_archived_bytes" toml:"max_archived_bytes"`
+	MaxHeadBytes     uint64 `yaml:"max_head_bytes" toml:"max_head_bytes"`
+}
+
+// tierConfig is a local directory or an S3 bucket reached with the S3 settings.
+type tierConfig struct {
+	Dir          string `yaml:"dir" toml:"dir"`
+	Bucket       string `yaml:"bucket" toml:"bucket"`
+	StorageClass string `yaml:"storage_class" toml:"storage_class"`
+}
+
+// parseTiers parses tiers given as name=dir or name=s3://bucket?storage_class=class, separated by commas.
+func parseTiers(v string) (map[string]tierConfig, error) {
+	tiers := map[string]tierConfig{}
+	for _, t := range strings.Split(v, ",") {
+		name, location, ok := strings.Cut(t, "=")
+		if !ok || name == "" || location == "" {
+			return nil, fmt.Errorf("tier %q is not name=location", t)
+		}
+
+		if !strings.HasPrefix(location, "s3://") {
+			tiers[name] = tierConfig{Dir: location}
+			continue
+		}
+
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid location of tier %q: %w", name, err)
+		}
+		tiers[name] = tierConfig{Bucket: u.Host, StorageClass: u.Query().Get("storage_class")}
+	}
+	return tiers, nil
+}
+
+// timeouts of the HTTP server, zero disables a timeout.
+type timeouts struct {
+	ReadHeader time.Duration `yaml:"read_header" toml:"read_header"`
+	Read       time.Duration `yaml:"read" toml:"read"`
+	Write      time.Duration `yaml:"write" toml:"write"`
+	Idle       time.Duration `yaml:"idle" toml:"idle"`
+	Shutdown   time.Duration `yaml:"shutdown" toml:"shutdown"`
+}
+
+func defaultServeConfig() serveConfig {
+	return serveConfig{
+		Listen:   ":8080",
+		LogLevel: slog.LevelInfo,
+		Timeouts: timeouts{
+			ReadHeader: 10 * time.Second,
+			Idle:       2 * time.Minute,
+			Shutdown:   30 * time.Second,
+		},
+	}
+}
+
+// setting is a config value that can be set by a flag and an environment variable.
+// The variable is the flag name in upper case with dashes replaced by underscores and the LINEAR_ prefix.
+type setting struct {
+	name  string
+	usage string
+	set   func(c *serveConfig, v string) error
+	// boolean settings can be given as a flag without a value
+	boolean bool
+}
+
+func (s setting) envName() string {
+	return "LINEAR_" + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+func stringSetting(name, usage string, field func(c *serveConfig) *string) setting {
+	return setting{name: name, usage: usage, set: func(c *serveConfig, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func boolSetting(name, usage string, field func(c *serveConfig) *bool) setting {
+	return setting{name: name, usage: usage, boolean: true, set: func(c *serveConfig, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(c *serveConfig) *time.Duration) setting {
+	return setting{name: name, usage: usage, set: func(c *serveConfig, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func uint64Setting(name, usage string, field func(c *serveConfig) *uint64) setting {
+	return setting{name: name, usage: usage, set: func(c *serveConfig, v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, field func(c *serveConfig) *int) setting {
+	return setting{name: name, usage: usage, set: func(c *serveConfig, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatSetting(name, usage string, field func(c *serveConfig) *float64) setting {
+	return setting{name: name, usage: usage, set: func(c *serveConfig, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("listen", "address to listen on", func(c *serveConfig) *string { return &c.Listen }),
+	{name: "log-level", usage: "log level: debug, info, warn or error", set: func(c *serveConfig, v string) error {
+		return c.LogLevel.UnmarshalText([]byte(v))
+	}},
+	stringSetting("state-dir", "directory of the dataset heads and the blobmap cache", func(c *serveConfig) *string { return &c.StateDir }),
+	stringSetting("archive-dir", "directory storing the archives instead of S3", func(c *serveConfig) *string { return &c.ArchiveDir }),
+	boolSetting("read-only", "serve archived entries only", func(c *serveConfig) *bool { return &c.ReadOnly }),
+	durationSetting("refresh-interval", "refresh interval of read-only datasets", func(c *serveConfig) *time.Duration { return &c.RefreshInterval }),
+	uint64Setting("cache-size", "size limit of the blobmap cache in bytes", func(c *serveConfig) *uint64 { return &c.CacheSize }),
+	boolSetting("archive-head-on-shutdown", "archive the heads of the datasets on shutdown", func(c *serveConfig) *bool { return &c.ArchiveHeadOnShutdown }),
+	{name: "tiers", usage: "tier stores as name=dir or name=s3://bucket?storage_class=class, separated by commas", set: func(c *serveConfig, v string) error {
+		tiers, err := parseTiers(v)
+		if err != nil {
+			return err
+		}
+		c.Tiers = tiers
+		return nil
+	}},
+	durationSetting("maintenance-interval", "period of compacting archives and applying tiering rules", func(c *serveConfig) *time.Duration { return &c.MaintenanceInterval }),
+	durationSetting("archive-lag-budget", "how long archiving can be overdue before /readyz fails", func(c *serveConfig) *time.Duration { return &c.ArchiveLagBudget }),
+	floatSetting("append-dataset-rate", "append requests per second to a dataset, 0 is unlimited", func(c *serveConfig) *float64 { return &c.AppendLimits.DatasetRate }),
+	intSetting("append-dataset-burst", "burst of append requests to a dataset, defaults to the rate", func(c *serveConfig) *int { return &c.AppendLimits.DatasetBurst }),
+	floatSetting("append-client-rate", "append requests per second of a client, 0 is unlimited", func(c *serveConfig) *float64 { return &c.AppendLimits.ClientRate }),
+	intSetting("append-client-burst", "burst of append requests of a client, defaults to the rate", func(c *serveConfig) *int { return &c.AppendLimits.ClientBurst }),
+	uint64Setting("max-head-bytes", "head size of a dataset past which appends are rejected, 0 disables", func(c *serveConfig) *uint64 { return &c.AppendLimits.MaxHeadBytes }),
+	uint64Setting("max-unarchived-entries", "unarchived entries of a dataset past which appends are rejected, 0 disables", func(c *serveConfig) *uint64 { return &c.AppendLimits.MaxUnarchivedEntries }),
+	stringSetting("s3-endpoint", "S3 endpoint, empty for AWS", func(c *serveConfig) *string { return &c.S3.Endpoint }),
+	stringSetting("s3-region", "S3 region", func(c *serveConfig) *string { return &c.S3.Region }),
+	stringSetting("s3-bucket", "S3 bucket", func(c *serveConfig) *string { return &c.S3.Bucket }),
+	stringSetting("s3-access-key-id", "S3 access key id, the AWS default credential chain is used when empty", func(c *serveConfig) *string { return &c.S3.AccessKeyID }),
+	stringSetting("s3-secret-access-key", "S3 secret access key", func(c *serveConfig) *string { return &c.S3.SecretAccessKey }),
+	boolSetting("s3-virtual-host-style", "address the bucket as a subdomain of the endpoint", func(c *serveConfig) *bool { return &c.S3.VirtualHostStyle }),
+	boolSetting("s3-disable-https", "use plain HTTP for endpoints without a scheme", func(c *serveConfig) *bool { return &c.S3.DisableHTTPS }),
+	stringSetting("s3-storage-class", "storage class of uploaded objects", func(c *serveConfig) *string { return &c.S3.StorageClass }),
+	stringSetting("tls-cert-file", "TLS certificate file, serves plain HTTP when empty", func(c *serveConfig) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key-file", "TLS key file", func(c *serveConfig) *string { return &c.TLS.KeyFile }),
+	stringSetting("tls-client-ca-file", "CA certificates verifying client certificates", func(c *serveConfig) *string { return &c.TLS.ClientCAFile }),
+	stringSetting("auth-hmac-key-file", "file with the key of signed tokens", func(c *serveConfig) *string { return &c.Auth.HMACKeyFile }),
+	durationSetting("read-header-timeout", "timeout of reading request headers", func(c *serveConfig) *time.Duration { return &c.Timeouts.ReadHeader }),
+	durationSetting("read-timeout", "timeout of reading requests", func(c *serveConfig) *time.Duration { return &c.Timeouts.Read }),
+	durationSetting("write-timeout", "timeout of writing responses", func(c *serveConfig) *time.Duration { return &c.Timeouts.Write }),
+	durationSetting("idle-timeout", "timeout of idle keep-alive connections", func(c *serveConfig) *time.Duration { return &c.Timeouts.Idle }),
+	durationSetting("shutdown-timeout", "time given to in-flight requests on shutdown", func(c *serveConfig) *time.Duration { return &c.Timeouts.Shutdown }),
+}
+
+// loadServeConfig builds the config from the defaults, the config file, the environment and the flags,
+// each overriding the previous one.
+func loadServeConfig(args []string, lookupEnv func(string) (string, bool)) (serveConfig, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	load := configFlags(fs, settings, lookupEnv)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return serveConfig{}, err
+	}
+
+	if fs.NArg() > 0 {
+		return serveConfig{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg, err := load()
+	if err != nil {
+		return serveConfig{}, err
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return serveConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// configFlags adds -config and the flags of settings to fs. Once the flags are parsed, the returned
+// function builds the config from the defaults, the config file, the environment and the flags.
+func configFlags(fs *flag.FlagSet, settings []setting, lookupEnv func(string) (string, bool)) func() (serveConfig, error) {
+	configFile, _ := lookupEnv("LINEAR_CONFIG")
+	fs.StringVar(&configFile, "config", configFile, "YAML or TOML config file (.toml), env LINEAR_CONFIG")
+
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+
+	flagValues := []flagValue{}
+
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s, env %s", s.usage, s.envName())
+		fn := func(v string) error {
+			// validate right away so that the flag package reports the bad flag
+			err := s.set(&serveConfig{}, v)
+			if err != nil {
+				return err
+			}
+			flagValues = append(flagValues, flagValue{s, v})
+			return nil
+		}
+
+		if s.boolean {
+			fs.BoolFunc(s.name, usage, fn)
+			continue
+		}
+		fs.Func(s.name, usage, fn)
+	}
+
+	return func() (serveConfig, error) {
+		cfg := defaultServeConfig()
+
+		if configFile != "" {
+			err := decodeConfigFile(configFile, &cfg)
+			if err != nil {
+				return serveConfig{}, err
+			}
+		}
+
+		for _, s := range settings {
+			v, ok := lookupEnv(s.envName())
+			if !ok {
+				continue
+			}
+			err := s.set(&cfg, v)
+			if err != nil {
+				return serveConfig{}, fmt.Errorf("invalid value %q of %s: %w", v, s.envName(), err)
+			}
+		}
+
+		for _, fv := range flagValues {
+			err := fv.setting.set(&cfg, fv.value)
+			if err != nil {
+				return serveConfig{}, err
+			}
+		}
+
+		return cfg, nil
+	}
+}
+
+func decodeConfigFile(fileName string, cfg *serveConfig) error {
+	d, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if filepath.Ext(fileName) == ".toml" {
+		md, err := toml.Decode(string(d), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to decode config file %s: %w", fileName, err)
+		}
+		undecoded := md.Undecoded()
+		if len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %s in config file %s", undecoded[0], fileName)
+		}
+		return nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(d))
+	dec.KnownFields(true)
+	err = dec.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to decode config file %s: %w", fileName, err)
+	}
+
+	return nil
+}
+
+func (c serveConfig) validate() error {
+	if c.StateDir == "" {
+		return errors.New("state dir is not set")
+	}
+
+	if c.ArchiveDir == "" && c.S3.Bucket == "" {
+		return errors.New("either the archive dir or the S3 bucket must be set")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("TLS needs both the cert file and the key file")
+	}
+
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return errors.New("client certificates need TLS")
+	}
+
+	for i, t := range c.Auth.Tokens {
+		if t.Token == "" || t.Subject == "" {
+			return fmt.Errorf("auth token %d needs both the token and the subject", i)
+		}
+	}
+
+	if len(c.Auth.Grants) > 0 && !c.authEnabled() {
+		return errors.New("auth grants need tokens, an HMAC key file or a client CA file")
+	}
+
+	err := c.policy().Validate()
+	if err != nil {
+		return fmt.Errorf("invalid auth grants: %w", err)
+	}
+
+	return nil
+}
+
+func (c serveConfig) authEnabled() bool {
+	return len(c.Auth.Tokens) > 0 || c.Auth.HMACKeyFile != "" || c.TLS.ClientCAFile != ""
+}
+
+func (c serveConfig) policy() auth.Policy {
+	p := auth.Policy{}
+	for _, g := range c.Auth.Grants {
+		perms := []auth.Permission{}
+		for _, perm := range g.Permissions {
+			perms = append(perms, auth.Permission(perm))
+		}
+		p.Grants = append(p.Grants, auth.Grant{
+			Subject:     g.Subject,
+			Datasets:    g.Datasets,
+			Permissions: perms,
+		})
+	}
+	return p
+}
+
+// minHMACKeySize is the size of the SHA-256 HMAC key recommended by RFC 2104.
+const minHMACKeySize = 32
+
+// authenticator creates the authenticator of the lead, nil if authentication is not enabled.
+func (c serveConfig) authenticator() (auth.Authenticator, error) {
+	if !c.authEnabled() {
+		return nil, nil
+	}
+
+	authenticators := []auth.Authenticator{}
+
+	if len(c.Auth.Tokens) > 0 {
+		tokens := map[string]string{}
+		for _, t := range c.Auth.Tokens {
+			tokens[t.Token] = t.Subject
+		}
+		authenticators = append(authenticators, auth.StaticTokens(tokens))
+	}
+
+	if c.Auth.HMACKeyFile != "" {
+		key, err := readHMACKey(c.Auth.HMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, auth.HMACTokens(key))
+	}
+
+	if c.TLS.ClientCAFile != "" {
+		authenticators = append(authenticators, auth.ClientCert())
+	}
+
+	return auth.Chain(authenticators...), nil
+}
+
+func readHMACKey(fileName string) ([]byte, error) {
+	d, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HMAC key file: %w", err)
+	}
+
+	key := bytes.TrimSpace(d)
+	if len(key) < minHMACKeySize {
+		return nil, fmt.Errorf("HMAC key in %s is shorter than %d bytes", fileName, minHMACKeySize)
+	}
+
+	return key, nil
+}
+
+func (c serveConfig) leadConfig() lead.Config {
+	return lead.Config{
+		S3: lead.S3{
+			Endpoint:         c.S3.Endpoint,
+			AccessKeyID:      c.S3.AccessKeyID,
+			SecretAccessKey:  c.S3.SecretAccessKey,
+			Region:           c.S3.Region,
+			Bucket:           c.S3.Bucket,
+			VirtualHostStyle: c.S3.VirtualHostStyle,
+			DisableHTTPS:     c.S3.DisableHTTPS,
+			StorageClass:     c.S3.StorageClass,
+		},
+		ArchiveDir:      c.ArchiveDir,
+		StateDir:        c.StateDir,
+		ReadOnly:        c.ReadOnly,
+		RefreshInterval: c.RefreshInterval,
+		CacheSize:       c.CacheSize,
+		// serve /healthz and /readyz while the archives of the datasets are listed
+		OpenInBackground:      true,
+		ArchiveLagBudget:      c.ArchiveLagBudget,
+		ArchiveHeadOnShutdown: c.ArchiveHeadOnShutdown,
+		Policy:                c.policy(),
+		Tenants:               c.tenants(),
+		Tiers:                 c.tiers(),
+		MaintenanceInterval:   c.MaintenanceInterval,
+		AppendLimits: lead.AppendLimits{
+			PerDataset:           lead.RateLimit{Rate: c.AppendLimits.DatasetRate, Burst: c.AppendLimits.DatasetBurst},
+			PerClient:            lead.RateLimit{Rate: c.AppendLimits.ClientRate, Burst: c.AppendLimits.ClientBurst},
+			MaxHeadBytes:         c.AppendLimits.MaxHeadBytes,
+			MaxUnarchivedEntries: c.AppendLimits.MaxUnarchivedEntries,
+		},
+	}
+}
+
+func (c serveConfig) tiers() map[string]lead.Tier {
+	if len(c.Tiers) == 0 {
+		return nil
+	}
+
+	tiers := map[string]lead.Tier{}
+	for name, t := range c.Tiers {
+		tiers[name] = lead.Tier{
+			Dir:          t.Dir,
+			Bucket:       t.Bucket,
+			StorageClass: t.StorageClass,
+		}
+	}
+	return tiers
+}
+
+func (c serveConfig) tenants() map[string]lead.Quota {
+	if len(c.Tenants) == 0 {
+		return nil
+	}
+
+	tenants := map[string]lead.Quota{}
+	for tenant, q := range c.Tenants {
+		tenants[tenant] = lead.Quota{
+			Datasets:      q.MaxDatasets,
+			ArchivedBytes: q.MaxArchivedBytes,
+			HeadBytes:     q.MaxHeadBytes,
+		}
+	}
+	return tenants
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/lead"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServeConfig(t *testing.T) {
+	writeFile := func(t *testing.T, name, content string) string {
+		p := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(k string) (string, bool) {
+			v, ok := vars[k]
+			return v, ok
+		}
+	}
+
+	t.Run("flags override env which overrides the config file", func(t *testing.T) {
+		configFile := writeFile(t, "linear.yaml", `
+listen: ":9000"
+state_dir: /var/lib/linear
+log_level: debug
+s3:
+  bucket: from-file
+  region: eu-west-1
+timeouts:
+  shutdown: 5s
+`)
+
+		cfg, err := loadServeConfig(
+			[]string{"-config", configFile, "-s3-bucket", "from-flag", "-read-only"},
+			env(map[string]string{
+				"LINEAR_S3_BUCKET":             "from-env",
+				"LINEAR_S3_REGION":             "us-east-1",
+				"LINEAR_S3_VIRTUAL_HOST_STYLE": "true",
+			}),
+		)
+		require.NoError(t, err)
+
+		require.Equal(t, ":9000", cfg.Listen)
+		require.Equal(t, "/var/lib/linear", cfg.StateDir)
+		require.Equal(t, slog.LevelDebug, cfg.LogLevel)
+		require.Equal(t, "from-flag", cfg.S3.Bucket)
+		require.Equal(t, "us-east-1", cfg.S3.Region)
+		require.True(t, cfg.S3.VirtualHostStyle)
+		require.True(t, cfg.ReadOnly)
+		require.Equal(t, 5*time.Second, cfg.Timeouts.Shutdown)
+		require.Equal(t, 10*time.Second, cfg.Timeouts.ReadHeader)
+	})
+
+	t.Run("toml config file from env", func(t *testing.T) {
+		configFile := writeFile(t, "linear.toml", `
+state_dir = "/var/lib/linear"
+archive_dir = "/srv/archive"
+refresh_interval = "1m"
+
+[tls]
+cert_file = "cert.pem"
+key_file = "key.pem"
+`)
+
+		cfg, err := loadServeConfig(nil, env(map[string]string{"LINEAR_CONFIG": configFile}))
+		require.NoError(t, err)
+
+		require.Equal(t, "/srv/archive", cfg.ArchiveDir)
+		require.Equal(t, time.Minute, cfg.RefreshInterval)
+		require.Equal(t, "cert.pem", cfg.TLS.CertFile)
+		require.Equal(t, ":8080", cfg.Listen)
+	})
+
+	t.Run("unknown key in config file", func(t *testing.T) {
+		configFile := writeFile(t, "linear.yaml", "state_dir: /tmp\nbucket: x\n")
+		_, err := loadServeConfig([]string{"-config", configFile}, env(nil))
+		require.ErrorContains(t, err, "bucket")
+	})
+
+	t.Run("invalid env value", func(t *testing.T) {
+		_, err := loadServeConfig(nil, env(map[string]string{
+			"LINEAR_STATE_DIR":        "/tmp",
+			"LINEAR_ARCHIVE_DIR":      "/tmp",
+			"LINEAR_SHUTDOWN_TIMEOUT": "soon",
+		}))
+		require.ErrorContains(t, err, "LINEAR_SHUTDOWN_TIMEOUT")
+	})
+
+	t.Run("missing store", func(t *testing.T) {
+		_, err := loadServeConfig([]string{"-state-dir", "/tmp"}, env(nil))
+		require.Error(t, err)
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		keyFile := writeFile(t, "hmac.key", "0123456789abcdef0123456789abcdef\n")
+		configFile := writeFile(t, "linear.yaml", `
+state_dir: /tmp
+archive_dir: /tmp
+auth:
+  tokens:
+    - token: secret
+      subject: ci
+  grants:
+    - subject: ci
+      datasets: ["events", "logs-*"]
+      permissions: [read, append]
+`)
+
+		cfg, err := loadServeConfig([]string{"-config", configFile, "-auth-hmac-key-file", keyFile}, env(nil))
+		require.NoError(t, err)
+
+		require.Equal(t, []auth.Grant{{
+			Subject:     "ci",
+			Datasets:    []string{"events", "logs-*"},
+			Permissions: []auth.Permission{auth.Read, auth.Append},
+		}}, cfg.leadConfig().Policy.Grants)
+
+		a, err := cfg.authenticator()
+		require.NoError(t, err)
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		id, err := a.Authenticate(r)
+		require.NoError(t, err)
+		require.Equal(t, "ci", id.Subject)
+	})
+
+	t.Run("auth grant with unknown permission", func(t *testing.T) {
+		configFile := writeFile(t, "linear.yaml", `
+state_dir: /tmp
+archive_dir: /tmp
+auth:
+  tokens:
+    - token: secret
+      subject: ci
+  grants:
+    - subject: ci
+      datasets: ["events"]
+      permissions: [write]
+`)
+
+		_, err := loadServeConfig([]string{"-config", configFile}, env(nil))
+		require.ErrorContains(t, err, "unknown permission")
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		configFile := writeFile(t, "linear.toml", `
+state_dir = "/tmp"
+archive_dir = "/tmp"
+
+[tenants.acme]
+max_datasets = 10
+max_head_bytes = 1048576
+
+[tenants.globex]
+`)
+
+		cfg, err := loadServeConfig([]string{"-config", configFile}, env(nil))
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]lead.Quota{
+			"acme":   {Datasets: 10, HeadBytes: 1048576},
+			"globex": {},
+		}, cfg.leadConfig().Tenants)
+	})
+
+	t.Run("tiers", func(t *testing.T) {
+		configFile := writeFile(t, "linear.yaml", `
+state_dir: /tmp
+archive_dir: /tmp/archive
+maintenance_interval: 1m
+tiers:
+  cold:
+    dir: /tmp/cold
+`)
+
+		cfg, err := loadServeConfig([]string{"-config", configFile}, env(nil))
+		require.NoError(t, err)
+		require.Equal(t, map[string]lead.Tier{"cold": {Dir: "/tmp/cold"}}, cfg.leadConfig().Tiers)
+		require.Equal(t, time.Minute, cfg.leadConfig().MaintenanceInterval)
+
+		cfg, err = loadServeConfig(
+			[]string{"-config", configFile, "-tiers", "cold=/mnt/cold,glacier=s3://linear-glacier?storage_class=GLACIER_IR"},
+			env(nil),
+		)
+		require.NoError(t, err)
+		require.Equal(t, map[string]lead.Tier{
+			"cold":    {Dir: "/mnt/cold"},
+			"glacier": {Bucket: "linear-glacier", StorageClass: "GLACIER_IR"},
+		}, cfg.leadConfig().Tiers)
+
+		_, err = loadServeConfig([]string{"-config", configFile}, env(map[string]string{"LINEAR_TIERS": "cold"}))
+		require.ErrorContains(t, err, "not name=location")
+	})
+
+	t.Run("append limits", func(t *testing.T) {
+		cfg, err := loadServeConfig(
+			[]string{"-state-dir", "/tmp", "-archive-dir", "/tmp", "-append-dataset-rate", "2.5", "-max-head-bytes", "1048576"},
+			env(map[string]string{"LINEAR_APPEND_CLIENT_BURST": "10"}),
+		)
+		require.NoError(t, err)
+
+		require.Equal(t, lead.AppendLimits{
+			PerDataset:   lead.RateLimit{Rate: 2.5},
+			PerClient:    lead.RateLimit{Burst: 10},
+			MaxHeadBytes: 1048576,
+		}, cfg.leadConfig().AppendLimits)
+	})
+
+	t.Run("tls needs cert and key", func(t *testing.T) {
+		_, err := loadServeConfig([]string{"-state-dir", "/tmp", "-archive-dir", "/tmp", "-tls-cert-file", "cert.pem"}, env(nil))
+		require.Error(t, err)
+	})
+}
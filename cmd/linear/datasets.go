@@ -0,0 +1,666 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/draganm/linear/client"
+	"github.com/draganm/linear/dataset"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// clientCommand holds the flags shared by the commands talking to a lead.
+type clientCommand struct {
+	fs         *flag.FlagSet
+	server     string
+	token      string
+	tenant     string
+	clientCert string
+	clientKey  string
+	caFile     string
+	httpClient *http.Client
+}
+
+func newClientCommand(name, args string) *clientCommand {
+	cc := &clientCommand{
+		fs: flag.NewFlagSet(name, flag.ContinueOnError),
+	}
+
+	server := os.Getenv("LINEAR_SERVER")
+	if server == "" {
+		server = defaultServer
+	}
+
+	cc.fs.StringVar(&cc.server, "server", server, "URL of the lead, env LINEAR_SERVER")
+	cc.fs.StringVar(&cc.token, "token", os.Getenv("LINEAR_TOKEN"), "bearer token authenticating to the lead, env LINEAR_TOKEN")
+	cc.fs.StringVar(&cc.tenant, "tenant", os.Getenv("LINEAR_TENANT"), "tenant of the datasets, the default tenant when empty, env LINEAR_TENANT")
+	cc.fs.StringVar(&cc.clientCert, "client-cert", os.Getenv("LINEAR_CLIENT_CERT"), "TLS client certificate file authenticating to the lead, env LINEAR_CLIENT_CERT")
+	cc.fs.StringVar(&cc.clientKey, "client-key", os.Getenv("LINEAR_CLIENT_KEY"), "key file of the TLS client certificate, env LINEAR_CLIENT_KEY")
+	cc.fs.StringVar(&cc.caFile, "ca-file", os.Getenv("LINEAR_CA_FILE"), "CA certificates verifying the lead instead of the system ones, env LINEAR_CA_FILE")
+	cc.fs.Usage = func() {
+		fmt.Fprintf(cc.fs.Output(), "usage: linear %s [flags] %s\n\nflags:\n", name, args)
+		cc.fs.PrintDefaults()
+	}
+
+	return cc
+}
+
+func (cc *clientCommand) parse(args []string, minArgs, maxArgs int) ([]string, error) {
+	positional, err := parseArgs(cc.fs, args, minArgs, maxArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	cc.httpClient, err = newHTTPClient(cc.clientCert, cc.clientKey, cc.caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return positional, nil
+}
+
+// newHTTPClient creates the HTTP client presenting the client certificate and verifying the lead
+// with the CA certificates in caFile, if they are given.
+func newHTTPClient(certFile, keyFile, caFile string) (*http.Client, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("the client certificate needs both the cert file and the key file")
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func loadCertPool(fileName string) (*x509.CertPool, error) {
+	d, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(d) {
+		return nil, fmt.Errorf("no certificates in CA file %s", fileName)
+	}
+
+	return pool, nil
+}
+
+// parseArgs parses flags given before, between and after the positional arguments
+// and checks that there are between minArgs and maxArgs of them.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	positional := []string{}
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+
+	return positional, nil
+}
+
+func (cc *clientCommand) client() *client.Client {
+	c := client.New(cc.server, cc.httpClient)
+	c.SetToken(cc.token)
+	c.SetTenant(cc.tenant)
+	return c
+}
+
+// filterFlags adds the flags of the server side filters of batch reads.
+func filterFlags(fs *flag.FlagSet) func() url.Values {
+	prefix := fs.String("prefix", "", "only entries starting with the hex encoded prefix")
+	field := fs.String("field", "", "only JSON entries where the value at this JSON pointer equals -value")
+	value := fs.String("value", "", "value of -field")
+
+	return func() url.Values {
+		q := url.Values{}
+		if *prefix != "" {
+			q.Set("prefix", *prefix)
+		}
+		if *field != "" {
+			q.Set("field", *field)
+			q.Set("value", *value)
+		}
+		return q
+	}
+}
+
+// resolveIndex parses an index, which can be first or last to refer to the bounds of the dataset.
+func resolveIndex(ctx context.Context, c *client.Client, name, s string) (uint64, error) {
+	if s != "first" && s != dataset.LastIndex {
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid index %q", s)
+		}
+		return i, nil
+	}
+
+	info, err := c.GetInfo(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if info.LastIndex == math.MaxUint64 {
+		return 0, fmt.Errorf("dataset %s is empty", name)
+	}
+
+	if s == "first" {
+		return info.FirstIndex, nil
+	}
+
+	return info.LastIndex, nil
+}
+
+func datasetsCommand(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "ls" {
+		args = args[1:]
+	}
+
+	cc := newClientCommand("datasets ls", "")
+	_, err := cc.parse(args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	names, err := cc.client().ListDatasets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list datasets: %w", err)
+	}
+
+	for _, n := range names {
+		fmt.Println(n)
+	}
+
+	return nil
+}
+
+func createCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("create", "<dataset>")
+	configFile := cc.fs.String("config", "", "JSON file with the dataset config, the other flags override it")
+	maxArchiveSize := cc.fs.Uint64("max-archive-size", 0, "archive the head once it holds this many bytes, 0 disables")
+	maxArchiveTime := cc.fs.Duration("max-archive-time", 0, "archive the head once its oldest entry is this old, 0 disables")
+
+	positional, err := cc.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	config := dataset.DatasetConfig{}
+
+	if *configFile != "" {
+		d, err := os.ReadFile(*configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read dataset config: %w", err)
+		}
+
+		err = json.Unmarshal(d, &config)
+		if err != nil {
+			return fmt.Errorf("failed to decode dataset config: %w", err)
+		}
+	}
+
+	cc.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-archive-size":
+			config.MaxArchiveSize = *maxArchiveSize
+		case "max-archive-time":
+			config.MaxArchiveTime = *maxArchiveTime
+		}
+	})
+
+	err = cc.client().CreateDataset(ctx, positional[0], config)
+	if err != nil {
+		return fmt.Errorf("failed to create dataset: %w", err)
+	}
+
+	return nil
+}
+
+func infoCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("info", "<dataset>")
+	positional, err := cc.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	info, err := cc.client().GetInfo(ctx, positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to get dataset info: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
+
+func getCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("get", "<dataset> <index|first|last>")
+	format := formatRaw
+	cc.fs.Var(&format, "format", "output format: hex, raw or json")
+
+	positional, err := cc.parse(args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	c := cc.client()
+	name := positional[0]
+
+	index, err := resolveIndex(ctx, c, name, positional[1])
+	if err != nil {
+		return err
+	}
+
+	data, err := c.Get(ctx, name, index)
+	if err != nil {
+		return fmt.Errorf("failed to get entry %d: %w", index, err)
+	}
+
+	return format.writeData(os.Stdout, index, data)
+}
+
+func rangeCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("range", "<dataset> <from|first> [to|last]")
+	format := formatHex
+	cc.fs.Var(&format, "format", "output format: hex, raw or json")
+	filter := filterFlags(cc.fs)
+
+	positional, err := cc.parse(args, 2, 3)
+	if err != nil {
+		return err
+	}
+
+	c := cc.client()
+	name := positional[0]
+
+	from, err := resolveIndex(ctx, c, name, positional[1])
+	if err != nil {
+		return err
+	}
+
+	to := uint64(math.MaxUint64)
+	if len(positional) == 3 {
+		to, err = resolveIndex(ctx, c, name, positional[2])
+		if err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	err = c.Range(ctx, name, from, to, client.BatchOptions{Filter: filter()}, func(index uint64, data []byte) error {
+		return format.writeEntry(w, index, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read entries: %w", err)
+	}
+
+	return nil
+}
+
+func tailCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("tail", "<dataset>")
+	format := formatHex
+	cc.fs.Var(&format, "format", "output format: hex, raw or json")
+	n := cc.fs.Uint64("n", 10, "number of entries to print")
+	follow := cc.fs.Bool("f", false, "keep printing entries as they are appended")
+	interval := cc.fs.Duration("interval", time.Second, "poll interval of -f")
+	filter := filterFlags(cc.fs)
+
+	positional, err := cc.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c := cc.client()
+	name := positional[0]
+
+	info, err := c.GetInfo(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get dataset info: %w", err)
+	}
+
+	next := uint64(0)
+	if info.LastIndex != math.MaxUint64 {
+		next = info.LastIndex + 1
+		if info.LastIndex-info.FirstIndex < *n {
+			next = info.FirstIndex
+		} else {
+			next -= *n
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	write := func(index uint64, data []byte) error {
+		next = index + 1
+		return format.writeEntry(w, index, data)
+	}
+
+	opts := client.BatchOptions{Filter: filter()}
+
+	if info.LastIndex != math.MaxUint64 && next <= info.LastIndex {
+		err = c.Range(ctx, name, next, info.LastIndex, opts, write)
+		if err != nil {
+			return fmt.Errorf("failed to read entries: %w", err)
+		}
+		// filtered entries are skipped, but should not be read again
+		next = info.LastIndex + 1
+	}
+
+	if !*follow {
+		return nil
+	}
+
+	for {
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+
+		info, err := c.GetInfo(ctx, name)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get dataset info: %w", err)
+		}
+
+		if info.LastIndex == math.MaxUint64 || info.LastIndex < next {
+			continue
+		}
+
+		err = c.Range(ctx, name, next, info.LastIndex, opts, write)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read entries: %w", err)
+		}
+		next = info.LastIndex + 1
+	}
+}
+
+// batcher sends entries with AppendMulti once they add up to maxBytes.
+type batcher struct {
+	ctx      context.Context
+	c        *client.Client
+	name     string
+	maxBytes int
+	entries  []client.Entry
+	size     int
+	count    uint64
+}
+
+func (b *batcher) add(index uint64, data []byte) error {
+	b.entries = append(b.entries, client.Entry{Index: index, Data: data})
+	b.size += 16 + len(data)
+	if b.size >= b.maxBytes {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *batcher) flush() error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+
+	err := b.c.AppendMulti(b.ctx, b.name, b.entries)
+	if err != nil {
+		return fmt.Errorf("failed to append entries %d-%d: %w", b.entries[0].Index, b.entries[len(b.entries)-1].Index, err)
+	}
+
+	b.count += uint64(len(b.entries))
+	b.entries = nil
+	b.size = 0
+
+	return nil
+}
+
+func appendCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("append", "<dataset>")
+	input := inputLines
+	cc.fs.Var(&input, "input", "format of stdin: lines (one entry per line) or length-prefixed (big endian uint64 length before each entry)")
+	indexFlag := cc.fs.String("index", "", "index of the first entry, defaults to the one following the last index")
+	batchBytes := cc.fs.Int("batch-bytes", 4*1024*1024, "bytes of entries sent per request")
+
+	positional, err := cc.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c := cc.client()
+	name := positional[0]
+
+	var index uint64
+	if *indexFlag != "" {
+		index, err = strconv.ParseUint(*indexFlag, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid index %q", *indexFlag)
+		}
+	} else {
+		info, err := c.GetInfo(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get dataset info: %w", err)
+		}
+		if info.LastIndex != math.MaxUint64 {
+			index = info.LastIndex + 1
+		}
+	}
+
+	b := &batcher{ctx: ctx, c: c, name: name, maxBytes: *batchBytes}
+
+	err = readInput(bufio.NewReader(os.Stdin), input, func(data []byte) error {
+		err := b.add(index, data)
+		index++
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "appended %d entries\n", b.count)
+
+	return nil
+}
+
+// readInput calls fn with the data of every entry in r. The data is not reused.
+func readInput(r *bufio.Reader, format inputFormat, fn func(data []byte) error) error {
+	if format == inputLengthPrefixed {
+		for {
+			var size uint64
+			err := binary.Read(r, binary.BigEndian, &size)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read entry length: %w", err)
+			}
+
+			if size > client.MaxEntrySize {
+				return fmt.Errorf("entry length %d is larger than the maximum of %d", size, client.MaxEntrySize)
+			}
+
+			data := make([]byte, size)
+			_, err = io.ReadFull(r, data)
+			if err != nil {
+				return fmt.Errorf("failed to read entry: %w", err)
+			}
+
+			err = fn(data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, client.MaxEntrySize)
+	for s.Scan() {
+		err := fn([]byte(s.Text()))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read line: %w", err)
+	}
+
+	return nil
+}
+
+// exportCommand has no filters: import appends the entries with AppendMulti, which needs
+// consecutive indexes.
+func exportCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("export", "<dataset>")
+	fromFlag := cc.fs.String("from", "first", "first index to export")
+	toFlag := cc.fs.String("to", "last", "last index to export")
+	output := cc.fs.String("o", "-", "output file")
+
+	positional, err := cc.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c := cc.client()
+	name := positional[0]
+
+	from, err := resolveIndex(ctx, c, name, *fromFlag)
+	if err != nil {
+		return err
+	}
+
+	to, err := resolveIndex(ctx, c, name, *toFlag)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer out.Close()
+	}
+
+	w := bufio.NewWriter(out)
+
+	err = c.Range(ctx, name, from, to, client.BatchOptions{}, func(index uint64, data []byte) error {
+		return client.WriteEntry(w, index, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export entries: %w", err)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	return out.Close()
+}
+
+func importCommand(ctx context.Context, args []string) error {
+	cc := newClientCommand("import", "<dataset>")
+	inputFile := cc.fs.String("i", "-", "file written by export")
+	batchBytes := cc.fs.Int("batch-bytes", 4*1024*1024, "bytes of entries sent per request")
+
+	positional, err := cc.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *inputFile != "-" {
+		in, err = os.Open(*inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer in.Close()
+	}
+
+	b := &batcher{ctx: ctx, c: cc.client(), name: positional[0], maxBytes: *batchBytes}
+
+	err = client.ReadEntries(bufio.NewReader(in), func(index uint64, data []byte) error {
+		return b.add(index, append([]byte(nil), data...))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "imported %d entries\n", b.count)
+
+	return nil
+}
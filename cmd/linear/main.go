@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `usage: linear <command> [flags]
+
+commands:
+  serve          run the linear server
+  datasets ls    list the datasets
+  create         create a dataset
+  info           print the config and the bounds of a dataset
+  get            print a single entry
+  range          print the entries of an index range
+  tail           print the last entries, and with -f the ones appended later
+  append         append entries read from stdin
+  export         write entries in the framing of batch responses
+  import         append entries written by export
+  archive        inspect the archive of a dataset in the store without a running lead
+  token          print a token signed with the HMAC key of the leads
+
+Commands talking to a lead use -server or LINEAR_SERVER and authenticate with -token or LINEAR_TOKEN,
+run linear <command> -h for their flags.
+linear serve exports traces over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+
+	commands := map[string]func(context.Context, []string) error{
+		"serve":    serve,
+		"datasets": datasetsCommand,
+		"create":   createCommand,
+		"info":     infoCommand,
+		"get":      getCommand,
+		"range":    rangeCommand,
+		"tail":     tailCommand,
+		"append":   appendCommand,
+		"export":   exportCommand,
+		"import":   importCommand,
+		"archive":  archiveCommand,
+		"token":    tokenCommand,
+	}
+
+	cmd, ok := commands[args[0]]
+	if ok {
+		return cmd(ctx, args[1:])
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stderr, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// entryFormat prints entries read from a dataset.
+type entryFormat string
+
+const (
+	formatHex  entryFormat = "hex"
+	formatRaw  entryFormat = "raw"
+	formatJSON entryFormat = "json"
+)
+
+func (f *entryFormat) String() string {
+	return string(*f)
+}
+
+func (f *entryFormat) Set(v string) error {
+	switch entryFormat(v) {
+	case formatHex, formatRaw, formatJSON:
+		*f = entryFormat(v)
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q, use hex, raw or json", v)
+	}
+}
+
+type jsonEntry struct {
+	Index uint64 `json:"index"`
+	Data  []byte `json:"data"`
+}
+
+// writeEntry prints an entry as index and hex encoded data, as raw data or as a JSON object
+// with base64 encoded data, each followed by a newline.
+func (f entryFormat) writeEntry(w io.Writer, index uint64, data []byte) error {
+	var err error
+	switch f {
+	case formatRaw:
+		_, err = fmt.Fprintf(w, "%s\n", data)
+	case formatJSON:
+		err = json.NewEncoder(w).Encode(jsonEntry{Index: index, Data: data})
+	default:
+		_, err = fmt.Fprintf(w, "%d\t%s\n", index, hex.EncodeToString(data))
+	}
+	return err
+}
+
+// writeData prints the data of a single entry, raw data is written as is.
+func (f entryFormat) writeData(w io.Writer, index uint64, data []byte) error {
+	if f == formatRaw {
+		_, err := w.Write(data)
+		return err
+	}
+	return f.writeEntry(w, index, data)
+}
+
+// inputFormat splits the input of append into entries.
+type inputFormat string
+
+const (
+	inputLines          inputFormat = "lines"
+	inputLengthPrefixed inputFormat = "length-prefixed"
+)
+
+func (f *inputFormat) String() string {
+	return string(*f)
+}
+
+func (f *inputFormat) Set(v string) error {
+	switch inputFormat(v) {
+	case inputLines, inputLengthPrefixed:
+		*f = inputFormat(v)
+		return nil
+	default:
+		return fmt.Errorf("unknown input format %q, use %s", v, strings.Join([]string{string(inputLines), string(inputLengthPrefixed)}, " or "))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryFormats(t *testing.T) {
+	for format, expected := range map[entryFormat]string{
+		formatHex:  "7\t6869\n",
+		formatRaw:  "hi\n",
+		formatJSON: "{\"index\":7,\"data\":\"aGk=\"}\n",
+	} {
+		buf := &bytes.Buffer{}
+		require.NoError(t, format.writeEntry(buf, 7, []byte("hi")))
+		require.Equal(t, expected, buf.String(), format)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	read := func(t *testing.T, input []byte, format inputFormat) []string {
+		entries := []string{}
+		err := readInput(bufio.NewReader(bytes.NewReader(input)), format, func(data []byte) error {
+			entries = append(entries, string(data))
+			return nil
+		})
+		require.NoError(t, err)
+		return entries
+	}
+
+	t.Run("lines", func(t *testing.T) {
+		require.Equal(t, []string{"a", "", "b c"}, read(t, []byte(strings.Join([]string{"a", "", "b c"}, "\n")), inputLines))
+	})
+
+	t.Run("length prefixed", func(t *testing.T) {
+		input := []byte{
+			0, 0, 0, 0, 0, 0, 0, 2, 'a', '\n',
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 1, 'b',
+		}
+		require.Equal(t, []string{"a\n", "", "b"}, read(t, input, inputLengthPrefixed))
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		err := readInput(bufio.NewReader(bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 5, 'a'})), inputLengthPrefixed, func(data []byte) error {
+			return nil
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/draganm/linear/lead"
+)
+
+func serve(ctx context.Context, args []string) error {
+	cfg, err := loadServeConfig(args, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	log := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}))
+
+	shutdownTracing, err := setupTracing(ctx, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			log.Warn("failed to flush traces", "error", err)
+		}
+	}()
+
+	leadCfg := cfg.leadConfig()
+	leadCfg.Authenticator, err = cfg.authenticator()
+	if err != nil {
+		return err
+	}
+
+	ld, err := lead.New(ctx, log, leadCfg)
+	if err != nil {
+		return fmt.Errorf("failed to start lead: %w", err)
+	}
+	defer ld.Close()
+
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           ld,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		ReadTimeout:       cfg.Timeouts.Read,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelWarn),
+	}
+
+	if cfg.TLS.ClientCAFile != "" {
+		pool, err := loadCertPool(cfg.TLS.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		// clients without certificates can still authenticate with tokens
+		srv.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+	}
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		if cfg.TLS.CertFile != "" {
+			serveErr <- srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			return
+		}
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	log.Info("serving", "addr", cfg.Listen, "tls", cfg.TLS.CertFile != "", "read_only", cfg.ReadOnly, "auth", leadCfg.Authenticator != nil)
+
+	select {
+	case err = <-serveErr:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Info("shutting down")
+
+	shutdownCtx := context.Background()
+	if cfg.Timeouts.Shutdown > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.Timeouts.Shutdown)
+		defer cancel()
+	}
+
+	// the lead answers 503 to new dataset requests while it drains, the server keeps
+	// answering probes until the lead is shut down
+	err = ld.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Error("failed to shut down lead", "error", err)
+	}
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	if err != nil {
+		log.Warn("in-flight requests did not finish before the shutdown timeout")
+		srv.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/draganm/linear/auth"
+)
+
+// tokenCommand prints a token signed with the HMAC key of the leads.
+func tokenCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	keyFile := fs.String("hmac-key-file", os.Getenv("LINEAR_AUTH_HMAC_KEY_FILE"), "file with the key of signed tokens, env LINEAR_AUTH_HMAC_KEY_FILE")
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: linear token [flags] <subject>\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if *keyFile == "" {
+		return errors.New("HMAC key file is not set")
+	}
+
+	key, err := readHMACKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(auth.SignToken(key, positional[0], time.Now().Add(*ttl)))
+
+	return nil
+}
@@ -10,7 +10,16 @@ import (
 )
 
 func (d *Dataset) Append(w http.ResponseWriter, r *http.Request) {
+	r, span := d.startSpan(r, "dataset.Append")
+	defer span.End()
+
 	log := d.log.With("method", r.Method, "path", r.URL.Path)
+
+	if d.readOnly {
+		log.Error("append to read-only dataset")
+		http.Error(w, "dataset is read-only", http.StatusMethodNotAllowed)
+		return
+	}
 	indexString := r.PathValue("index")
 
 	if indexString == "" {
@@ -33,14 +42,17 @@ func (d *Dataset) Append(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = d.head.Append(index, data)
+	err = d.appendEntry(index, data)
 
 	switch err {
-	case statemate.ErrIndexGapsAreNotAllowed, statemate.ErrIndexMustBeIncreasing:
+	case statemate.ErrIndexGapsAreNotAllowed, statemate.ErrIndexMustBeIncreasing, ErrIndexOutOfRange:
 		log.Error("failed to append", "error", err)
 		http.Error(w, fmt.Sprintf("failed to append: %v", err), http.StatusBadRequest)
+	case ErrShuttingDown:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 	default:
 		log.Error("failed to append", "error", err)
+		failSpan(r, err)
 		http.Error(w, "failed to append", http.StatusInternalServerError)
 	case nil:
 		w.WriteHeader(http.StatusNoContent)
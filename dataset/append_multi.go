@@ -8,8 +8,17 @@ import (
 )
 
 func (d *Dataset) AppendMulti(w http.ResponseWriter, r *http.Request) {
+	r, span := d.startSpan(r, "dataset.AppendMulti")
+	defer span.End()
+
 	log := d.log.With("method", r.Method, "path", r.URL.Path)
 
+	if d.readOnly {
+		log.Error("append to read-only dataset")
+		http.Error(w, "dataset is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
 	for {
 		var index uint64
 		err := binary.Read(r.Body, binary.BigEndian, &index)
@@ -35,7 +44,12 @@ func (d *Dataset) AppendMulti(w http.ResponseWriter, r *http.Request) {
 		data := make([]byte, length)
 		_, err = io.ReadFull(r.Body, data)
 
-		err = d.head.Append(index, data)
+		err = d.appendEntry(index, data)
+		if err == ErrShuttingDown {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
 		if err != nil {
 			log.Error("failed to append", "error", err)
 			http.Error(w, fmt.Sprintf("failed to append: %v", err), http.StatusBadRequest)
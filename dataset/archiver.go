@@ -0,0 +1,217 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/draganm/statemate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const archiveCheckInterval = 10 * time.Second
+
+// startArchiver archives the head whenever it exceeds MaxArchiveSize or holds entries older than MaxArchiveTime.
+func (d *Dataset) startArchiver() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stopArchiver = cancel
+	d.finishArchiver = make(chan struct{})
+	d.archiverDone = make(chan struct{})
+
+	go func() {
+		defer close(d.archiverDone)
+
+		ticker := time.NewTicker(archiveCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			err := d.archiveHead(ctx, false)
+			if err != nil && ctx.Err() == nil {
+				d.log.Error("failed to archive head", "error", err)
+			}
+
+			d.archiverMu.Lock()
+			d.archiveErr = err
+			d.archiverMu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.finishArchiver:
+				return
+			case <-ticker.C:
+			case <-d.archiveTrigger:
+			}
+		}
+	}()
+}
+
+// archiveHead seals the head if it is due, or with force if it is not empty, and archives the sealed head.
+// The sealed head stays readable until its entries are readable from the archive.
+func (d *Dataset) archiveHead(ctx context.Context, force bool) (err error) {
+	d.headLock.RLock()
+	sealed := d.sealed
+	headEmpty := d.head.sm.IsEmpty()
+	d.headLock.RUnlock()
+
+	if sealed == nil {
+		if headEmpty || !force && !d.archiveDue() {
+			return nil
+		}
+
+		sealed, err = d.sealHead()
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, span := tracer.Start(ctx, "dataset.archiveHead", trace.WithAttributes(attribute.String("linear.dataset", d.name)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if !sealed.sm.IsEmpty() {
+		_, archivedLast, archived := d.archive.Bounds()
+		sealedLast := sealed.sm.GetLastIndex()
+
+		// the sealed head can already be archived if the process stopped before removing it
+		if !archived || archivedLast < sealedLast {
+			err := d.archive.Append(ctx, sealed.sm)
+			if err != nil {
+				return fmt.Errorf("failed to archive sealed head: %w", err)
+			}
+
+			d.archiverMu.Lock()
+			d.lastArchived = time.Now()
+			d.archiverMu.Unlock()
+		}
+
+		d.dropHeadKeys(sealedLast)
+	}
+
+	d.headLock.Lock()
+	d.sealed = nil
+	d.headLock.Unlock()
+
+	return sealed.remove()
+}
+
+func (d *Dataset) archiveDue() bool {
+	d.headLock.RLock()
+	defer d.headLock.RUnlock()
+
+	if d.head.sm.IsEmpty() {
+		return false
+	}
+
+	if d.config.MaxArchiveSize > 0 && d.head.storageBytes() >= d.config.MaxArchiveSize {
+		return true
+	}
+
+	firstAppend := d.head.firstAppend.Load()
+	return d.config.MaxArchiveTime > 0 && firstAppend != 0 && time.Since(time.Unix(0, firstAppend)) >= d.config.MaxArchiveTime
+}
+
+// sealHead replaces the head with an empty one, returning the sealed head.
+func (d *Dataset) sealHead() (*headSegment, error) {
+	d.headLock.Lock()
+	defer d.headLock.Unlock()
+
+	next, err := openHeadSegment(d.headsDir, d.head.seq+1)
+	if err != nil {
+		return nil, err
+	}
+
+	d.sealed = d.head
+	d.sealed.sealedAt.Store(time.Now().UnixNano())
+	d.head = next
+
+	return d.sealed, nil
+}
+
+// ErrIndexOutOfRange is returned by appends of math.MaxUint64, which cannot be archived.
+var ErrIndexOutOfRange = errors.New("index out of range")
+
+// ErrShuttingDown is returned by appends once Shutdown has been called.
+var ErrShuttingDown = errors.New("dataset is shutting down")
+
+// appendEntry appends to the head, which has to continue where the sealed head or the archive ends.
+func (d *Dataset) appendEntry(index uint64, data []byte) (err error) {
+	defer func(start time.Time) { d.metrics.observeAppend(len(data), start, err) }(time.Now())
+
+	if index == math.MaxUint64 {
+		return ErrIndexOutOfRange
+	}
+
+	d.headLock.RLock()
+	defer d.headLock.RUnlock()
+
+	// checked holding the head lock, Shutdown takes the lock after setting it
+	if d.shuttingDown.Load() {
+		return ErrShuttingDown
+	}
+
+	if d.head.sm.IsEmpty() {
+		last, ok := d.lastIndex()
+		switch {
+		case ok && index <= last:
+			return statemate.ErrIndexMustBeIncreasing
+		case ok && index-last > 1:
+			return statemate.ErrIndexGapsAreNotAllowed
+		}
+	}
+
+	err = d.head.sm.Append(index, data)
+	if err != nil {
+		return err
+	}
+
+	d.head.firstAppend.CompareAndSwap(0, time.Now().UnixNano())
+	d.indexEntry(index, data)
+
+	if d.config.MaxArchiveSize > 0 && d.head.storageBytes() >= d.config.MaxArchiveSize {
+		select {
+		case d.archiveTrigger <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// lastIndex returns the last index of the sealed head or the archive.
+// The caller must hold headLock.
+func (d *Dataset) lastIndex() (uint64, bool) {
+	if d.sealed != nil && !d.sealed.sm.IsEmpty() {
+		return d.sealed.sm.GetLastIndex(), true
+	}
+
+	_, last, ok := d.archive.Bounds()
+	return last, ok
+}
+
+// dropHeadKeys removes archived entries up to index from the key index of the head.
+func (d *Dataset) dropHeadKeys(index uint64) {
+	d.headKeysMu.Lock()
+	defer d.headKeysMu.Unlock()
+
+	for k, indexes := range d.headKeys {
+		indexes = slices.DeleteFunc(indexes, func(i uint64) bool {
+			return i <= index
+		})
+		if len(indexes) == 0 {
+			delete(d.headKeys, k)
+			continue
+		}
+		d.headKeys[k] = indexes
+	}
+}
@@ -0,0 +1,72 @@
+package dataset_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/objectstore"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveHead(t *testing.T) {
+	t.Parallel()
+
+	store := objectstore.NewMemory()
+
+	config := dataset.DatasetConfig{
+		MaxArchiveSize: 100,
+		MaxArchiveTime: 24 * time.Hour,
+	}
+
+	withDatasetStore(t, config, store, func(ctx context.Context, url string) {
+		for i := 0; i < 20; i++ {
+			res, err := resty.New().R().SetBody([]byte(fmt.Sprintf("entry-%03d", i))).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+		}
+
+		require.Eventually(t, func() bool {
+			objects, err := store.List(ctx, "test-dataset/blobs/")
+			require.NoError(t, err)
+			return len(objects) > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		res, err := resty.New().R().Get(url + "/dataset/0/20")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		body := res.Body()
+		for i := uint64(0); i < 20; i++ {
+			require.Equal(t, i, binary.BigEndian.Uint64(body))
+			size := binary.BigEndian.Uint64(body[8:])
+			require.Equal(t, fmt.Sprintf("entry-%03d", i), string(body[16:16+size]))
+			body = body[16+size:]
+		}
+		require.Empty(t, body)
+
+		res, err = resty.New().R().SetBody([]byte("old")).Put(url + "/dataset/5")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte("gap")).Put(url + "/dataset/22")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte("next")).Put(url + "/dataset/20")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		var info dataset.DatasetInfo
+		res, err = resty.New().R().SetResult(&info).Get(url + "/dataset")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, uint64(0), info.FirstIndex)
+		require.Equal(t, uint64(20), info.LastIndex)
+	})
+}
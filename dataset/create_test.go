@@ -9,50 +9,70 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/linear/blobmapcache"
 	"github.com/draganm/linear/dataset"
 	"github.com/draganm/linear/e2eutils"
+	"github.com/draganm/linear/objectstore"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/require"
 )
 
 func withDataset(t *testing.T, fn func(ctx context.Context, url string)) {
+	withDatasetConfig(
+		t,
+		dataset.DatasetConfig{
+			MaxArchiveSize: 100,
+			MaxArchiveTime: 24 * time.Hour,
+		},
+		fn,
+	)
+}
 
-	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
-		dataDir := t.TempDir()
+func withDatasetConfig(t *testing.T, config dataset.DatasetConfig, fn func(ctx context.Context, url string)) {
+	withDatasetStore(t, config, objectstore.NewMemory(), fn)
+}
 
-		ds, err := dataset.Create(
-			ctx,
-			dataset.CreateOptions{
-				Log:      slog.Default(),
-				S3Client: s3Client,
-				S3Bucket: "test-bucket",
-				Config: dataset.DatasetConfig{
-					MaxArchiveSize: 100,
-					MaxArchiveTime: 24 * time.Hour,
-				},
-				Name:     "test-dataset",
-				LocalDir: dataDir,
-			},
-		)
+func withDatasetStore(t *testing.T, config dataset.DatasetConfig, store objectstore.Store, fn func(ctx context.Context, url string)) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
 
-		require.NoError(t, err)
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
 
-		defer ds.Close()
+	ds, err := dataset.Create(
+		ctx,
+		dataset.CreateOptions{
+			Log:          slog.Default(),
+			Store:        store,
+			Config:       config,
+			Name:         "test-dataset",
+			LocalDir:     dataDir,
+			BlobmapCache: bmc,
+		},
+	)
 
-		r := http.NewServeMux()
+	require.NoError(t, err)
 
-		r.HandleFunc("GET /dataset", ds.GetInfo)
-		r.HandleFunc("GET /dataset/{index}", ds.Get)
-		r.HandleFunc("GET /dataset/{index}/{count}", ds.GetBatch)
-		r.HandleFunc("PUT /dataset/{index}", ds.Append)
-		r.HandleFunc("POST /dataset", ds.AppendMulti)
+	defer ds.Close()
 
-		s := httptest.NewServer(r)
-		defer s.Close()
+	fn(ctx, serveDataset(t, ds))
+}
 
-		fn(ctx, s.URL)
-	})
+func serveDataset(t *testing.T, ds *dataset.Dataset) string {
+	r := http.NewServeMux()
+
+	r.HandleFunc("GET /dataset", ds.GetInfo)
+	r.HandleFunc("GET /dataset/{index}", ds.Get)
+	r.HandleFunc("GET /dataset/{index}/{count}", ds.GetBatch)
+	r.HandleFunc("GET /dataset/by-key/{key}", ds.GetByKey)
+	r.HandleFunc("PUT /dataset/{index}", ds.Append)
+	r.HandleFunc("POST /dataset", ds.AppendMulti)
 
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+
+	return s.URL
 }
 
 func TestLead(t *testing.T) {
@@ -61,18 +81,22 @@ func TestLead(t *testing.T) {
 	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
 		dataDir := t.TempDir()
 
+		bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+		require.NoError(t, err)
+		defer bmc.Close()
+
 		ds, err := dataset.Create(
 			ctx,
 			dataset.CreateOptions{
-				Log:      slog.Default(),
-				S3Client: s3Client,
-				S3Bucket: "test-bucket",
+				Log:   slog.Default(),
+				Store: objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}),
 				Config: dataset.DatasetConfig{
 					MaxArchiveSize: 100,
 					MaxArchiveTime: 24 * time.Hour,
 				},
-				Name:     "test-dataset",
-				LocalDir: dataDir,
+				Name:         "test-dataset",
+				LocalDir:     dataDir,
+				BlobmapCache: bmc,
 			},
 		)
 
@@ -7,97 +7,331 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"path"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/draganm/statemate"
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/keyindex"
+	"github.com/draganm/linear/objectstore"
 )
 
 type DatasetConfig struct {
-	MaxArchiveSize uint64        `json:"max_archive_size"`
-	MaxArchiveTime time.Duration `json:"max_archive_time"`
+	MaxArchiveSize uint64           `json:"max_archive_size"`
+	MaxArchiveTime time.Duration    `json:"max_archive_time"`
+	KeyExtractor   *keyindex.Config `json:"key_extractor,omitempty"`
+	// Tiering rules move archived blobs to colder stores, see CreateOptions.Tiers.
+	Tiering []archive.TieringRule `json:"tiering,omitempty"`
+	// CompactionTargetSize enables merging adjacent small archived blobs into blobs of up to this size.
+	CompactionTargetSize uint64 `json:"compaction_target_size,omitempty"`
 }
 
 type Dataset struct {
-	log      *slog.Logger
-	config   DatasetConfig
-	name     string
-	localDir string
-	s3Client *s3.Client
-	head     *statemate.StateMate[uint64]
+	log             *slog.Logger
+	config          DatasetConfig
+	name            string
+	localDir        string
+	store           objectstore.Store
+	readOnly        bool
+	headsDir        string
+	headLock        sync.RWMutex
+	head            *headSegment
+	sealed          *headSegment
+	archive         *archive.Archive
+	keyExtractor    keyindex.Extractor
+	headKeys        keyindex.Index
+	headKeysMu      sync.RWMutex
+	stopMaintenance context.CancelFunc
+	maintenanceDone chan struct{}
+	archiveTrigger  chan struct{}
+	stopArchiver    context.CancelFunc
+	// finishArchiver is closed to stop the archiver once its current run is done
+	finishArchiver chan struct{}
+	archiverDone   chan struct{}
+	shuttingDown   atomic.Bool
+	// archiverMu guards the outcome of the last archiver run
+	archiverMu   sync.Mutex
+	archiveErr   error
+	lastArchived time.Time
+	metrics      *metrics
 }
 
 type OpenOptions struct {
-	S3Client *s3.Client
-	S3Bucket string
+	Store    objectstore.Store
 	Name     string
 	LocalDir string
+	// BlobmapCache is not used, and can be nil, if the stores keep objects in local files.
+	BlobmapCache *blobmapcache.BlobmapCache
+	// Tiers are the stores named by the tiering rules of the config.
+	Tiers map[string]objectstore.Store
+	// MaintenanceInterval is the period of compaction and applying the tiering rules, defaults to DefaultMaintenanceInterval.
+	MaintenanceInterval time.Duration
+	// ReadOnly opens a replica serving the archived entries only. It keeps no head, rejects
+	// appends and refreshes the archive every RefreshInterval to pick up newly archived entries.
+	ReadOnly bool
+	// RefreshInterval of read-only replicas, defaults to DefaultRefreshInterval.
+	RefreshInterval time.Duration
 }
 
+const DefaultRefreshInterval = 30 * time.Second
+
+// Open opens an existing dataset.
 func Open(
 	ctx context.Context,
 	log *slog.Logger,
 	opts OpenOptions,
 ) (*Dataset, error) {
-	return nil, errors.New("not implemented")
+	r, err := opts.Store.Get(ctx, configKey(opts.Name))
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset config: %w", err)
+	}
+	defer r.Close()
+
+	var config DatasetConfig
+	err = json.NewDecoder(r).Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dataset config: %w", err)
+	}
+
+	return open(ctx, log, config, opts)
 }
 
 type CreateOptions struct {
-	Log      *slog.Logger
-	S3Client *s3.Client
-	S3Bucket string
-	Config   DatasetConfig
-	Name     string
-	LocalDir string
+	Log          *slog.Logger
+	Store        objectstore.Store
+	Config       DatasetConfig
+	Name         string
+	LocalDir     string
+	BlobmapCache *blobmapcache.BlobmapCache
+	// Tiers are the stores named by the tiering rules of the config.
+	Tiers map[string]objectstore.Store
+	// MaintenanceInterval is the period of compaction and applying the tiering rules, defaults to DefaultMaintenanceInterval.
+	MaintenanceInterval time.Duration
 }
 
+var (
+	ErrNotFound      = errors.New("dataset not found")
+	ErrAlreadyExists = errors.New("dataset already exists")
+	ErrInvalidConfig = errors.New("invalid dataset config")
+)
+
+func configKey(name string) string {
+	return path.Join(name, "dataset.json")
+}
+
+// Create creates a new dataset, failing with ErrAlreadyExists if a dataset with the name exists.
 func Create(
 	ctx context.Context,
 	opts CreateOptions,
 ) (*Dataset, error) {
 
-	key := path.Join(opts.Name, "dataset.json")
+	_, err := opts.Config.KeyExtractor.Extractor()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid key extractor: %w", ErrInvalidConfig, err)
+	}
+
+	for _, r := range opts.Config.Tiering {
+		_, ok := opts.Tiers[r.Tier]
+		if !ok {
+			return nil, fmt.Errorf("%w: tiering rule refers to unknown tier %q", ErrInvalidConfig, r.Tier)
+		}
+	}
 
 	d, err := json.Marshal(opts.Config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal dataset config: %w", err)
 	}
 
-	_, err = opts.S3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &opts.S3Bucket,
-		Key:    &key,
-		Body:   bytes.NewReader(d),
+	err = opts.Store.PutIfAbsent(ctx, configKey(opts.Name), bytes.NewReader(d))
+	if errors.Is(err, objectstore.ErrAlreadyExists) {
+		return nil, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dataset: %w", err)
+	}
+
+	return open(ctx, opts.Log, opts.Config, OpenOptions{
+		Store:               opts.Store,
+		Name:                opts.Name,
+		LocalDir:            opts.LocalDir,
+		BlobmapCache:        opts.BlobmapCache,
+		Tiers:               opts.Tiers,
+		MaintenanceInterval: opts.MaintenanceInterval,
 	})
+}
+
+func open(
+	ctx context.Context,
+	log *slog.Logger,
+	config DatasetConfig,
+	opts OpenOptions,
+) (*Dataset, error) {
 
+	keyExtractor, err := config.KeyExtractor.Extractor()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create dataset: %w", err)
+		return nil, fmt.Errorf("invalid key extractor: %w", err)
 	}
 
-	statemateFile := filepath.Join(opts.LocalDir, "head")
+	workDir := filepath.Join(opts.LocalDir, "work")
+	err = os.MkdirAll(workDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
 
-	sm, err := statemate.Open[uint64](statemateFile, statemate.Options{
-		AllowGaps: false,
-	})
+	archiveOptions := archive.OpenOptions{
+		Store:        opts.Store,
+		Name:         opts.Name,
+		BlobmapCache: opts.BlobmapCache,
+		WorkDir:      workDir,
+		KeyExtractor: keyExtractor,
+		Tiers:        opts.Tiers,
+	}
+
+	if opts.ReadOnly {
+		archiveOptions.RefreshInterval = opts.RefreshInterval
+		if archiveOptions.RefreshInterval <= 0 {
+			archiveOptions.RefreshInterval = DefaultRefreshInterval
+		}
+	}
+
+	ar, err := archive.Open(ctx, log, archiveOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	ds := &Dataset{
+		log:            log,
+		config:         config,
+		name:           opts.Name,
+		localDir:       opts.LocalDir,
+		store:          opts.Store,
+		readOnly:       opts.ReadOnly,
+		archive:        ar,
+		keyExtractor:   keyExtractor,
+		headKeys:       keyindex.Index{},
+		archiveTrigger: make(chan struct{}, 1),
+		metrics:        newMetrics(opts.Name),
+	}
+
+	if opts.ReadOnly {
+		return ds, nil
+	}
 
+	ds.headsDir = filepath.Join(opts.LocalDir, "heads")
+
+	ds.head, ds.sealed, err = openHeads(ds.headsDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open statemate: %w", err)
+		ar.Close()
+		return nil, err
 	}
 
-	// TODO: create statemate
+	err = ds.indexHead()
+	if err != nil {
+		ds.closeHeads()
+		ar.Close()
+		return nil, err
+	}
+
+	ds.startArchiver()
+
+	if len(config.Tiering) > 0 || config.CompactionTargetSize > 0 {
+		ds.startMaintenance(opts.MaintenanceInterval)
+	}
+
+	return ds, nil
+
+}
+
+// Name returns the name of the dataset.
+func (d *Dataset) Name() string {
+	return d.name
+}
+
+// ReadOnly reports whether the dataset is a read-only replica.
+func (d *Dataset) ReadOnly() bool {
+	return d.readOnly
+}
+
+// closeHeads closes the heads once the reads in progress are done with them.
+func (d *Dataset) closeHeads() error {
+	d.headLock.Lock()
+	defer d.headLock.Unlock()
 
-	return &Dataset{
-		log:      opts.Log,
-		config:   opts.Config,
-		name:     opts.Name,
-		localDir: opts.LocalDir,
-		s3Client: opts.S3Client,
-		head:     sm,
-	}, nil
+	errs := []error{}
 
+	for _, s := range []*headSegment{d.sealed, d.head} {
+		if s == nil {
+			continue
+		}
+		s.readers.Wait()
+		errs = append(errs, s.sm.Close())
+	}
+
+	return errors.Join(errs...)
 }
 
 func (d *Dataset) Close() error {
-	return d.head.Close()
+	if d.stopMaintenance != nil {
+		d.stopMaintenance()
+		<-d.maintenanceDone
+	}
+
+	if d.stopArchiver != nil {
+		d.stopArchiver()
+		<-d.archiverDone
+	}
+
+	return errors.Join(d.archive.Close(), d.closeHeads())
+}
+
+type ShutdownOptions struct {
+	// ArchiveHead seals and archives the head, leaving no entries that are only stored locally.
+	ArchiveHead bool
+}
+
+// Shutdown stops accepting appends, lets a running archiving finish, archives the head if
+// requested and closes the dataset. Once ctx is done, archiving is canceled and the dataset
+// is closed right away, entries left in the heads are archived after the next Open.
+func (d *Dataset) Shutdown(ctx context.Context, opts ShutdownOptions) error {
+	if d.shuttingDown.Swap(true) {
+		return nil
+	}
+
+	if d.readOnly {
+		return d.Close()
+	}
+
+	// appends in progress hold the lock, later ones see shuttingDown
+	d.headLock.Lock()
+	d.headLock.Unlock()
+
+	close(d.finishArchiver)
+	select {
+	case <-d.archiverDone:
+	case <-ctx.Done():
+		d.log.Warn("archiving did not finish before the shutdown deadline")
+		d.stopArchiver()
+		<-d.archiverDone
+	}
+
+	var err error
+	if opts.ArchiveHead && ctx.Err() == nil {
+		// a sealed head waiting for the archiver is archived first, then the head is sealed and archived
+		for range 2 {
+			err = d.archiveHead(ctx, true)
+			if err != nil {
+				err = fmt.Errorf("failed to archive head: %w", err)
+				break
+			}
+		}
+	}
+
+	return errors.Join(err, d.Close())
 }
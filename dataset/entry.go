@@ -0,0 +1,28 @@
+package dataset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// writeEntry writes an entry framed as big endian index, big endian size and data.
+func writeEntry(w io.Writer, index uint64, data []byte) error {
+	err := binary.Write(w, binary.BigEndian, index)
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	size := uint64(len(data))
+
+	err = binary.Write(w, binary.BigEndian, size)
+	if err != nil {
+		return fmt.Errorf("failed to write size: %w", err)
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	return nil
+}
@@ -1,13 +1,18 @@
 package dataset
 
 import (
+	"errors"
+	"math"
 	"net/http"
-	"strconv"
 
+	"github.com/draganm/linear/archive"
 	"github.com/draganm/statemate"
 )
 
 func (d *Dataset) Get(w http.ResponseWriter, r *http.Request) {
+	r, span := d.startSpan(r, "dataset.Get")
+	defer span.End()
+
 	log := d.log.With("method", r.Method, "path", r.URL.Path)
 
 	indexString := r.PathValue("index")
@@ -18,21 +23,56 @@ func (d *Dataset) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	index, err := strconv.ParseUint(indexString, 10, 64)
+	index, err := d.parseIndex(indexString)
+	if err == errEmptyDataset {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
 	if err != nil {
 		log.Error("failed to parse index", "error", err)
 		http.Error(w, "invalid index", http.StatusBadRequest)
 		return
 	}
 
-	err = d.head.Read(index, func(data []byte) error {
+	q := r.URL.Query()
+	if q.Has("limit") || q.Has("maxBytes") {
+		limit, err := parseUintQuery(r, "limit", math.MaxUint64)
+		if err != nil {
+			log.Error("failed to parse limit", "error", err)
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		maxBytes, err := parseUintQuery(r, "maxBytes", math.MaxUint64)
+		if err != nil {
+			log.Error("failed to parse maxBytes", "error", err)
+			http.Error(w, "invalid maxBytes", http.StatusBadRequest)
+			return
+		}
+
+		d.writePage(w, r, log, index, limit, maxBytes)
+		return
+	}
+
+	found := false
+	err = d.readRange(r.Context(), index, 1, func(i uint64, data []byte) error {
+		found = true
 		w.Header().Set("Content-Type", "application/octet-stream")
 		_, err := w.Write(data)
 		return err
 	})
 
-	if err == statemate.ErrNotFound {
+	var notArchived *archive.ErrRangeNotArchived
+	if err == statemate.ErrNotFound || errors.As(err, &notArchived) || (err == nil && !found) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+
+	if err != nil {
+		log.Error("failed to access data", "error", err)
+		failSpan(r, err)
+		http.Error(w, "failed to access data", http.StatusInternalServerError)
+		return
+	}
 }
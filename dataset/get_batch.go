@@ -1,15 +1,15 @@
 package dataset
 
 import (
-	"encoding/binary"
-	"fmt"
+	"math"
 	"net/http"
 	"strconv"
-
-	"github.com/draganm/statemate"
 )
 
 func (d *Dataset) GetBatch(w http.ResponseWriter, r *http.Request) {
+	r, span := d.startSpan(r, "dataset.GetBatch")
+	defer span.End()
+
 	log := d.log.With("method", r.Method, "path", r.URL.Path)
 
 	indexString := r.PathValue("index")
@@ -20,7 +20,12 @@ func (d *Dataset) GetBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	index, err := strconv.ParseUint(indexString, 10, 64)
+	index, err := d.parseIndex(indexString)
+	if err == errEmptyDataset {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
 	if err != nil {
 		log.Error("failed to parse index", "error", err)
 		http.Error(w, "invalid index", http.StatusBadRequest)
@@ -42,39 +47,12 @@ func (d *Dataset) GetBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-
-	for i := index; i < index+count; i++ {
-
-		err = d.head.Read(i, func(data []byte) error {
-			err := binary.Write(w, binary.BigEndian, uint64(i))
-			if err != nil {
-				return fmt.Errorf("failed to write index: %w", err)
-			}
-			size := uint64(len(data))
-
-			err = binary.Write(w, binary.BigEndian, size)
-			if err != nil {
-				return fmt.Errorf("failed to write size: %w", err)
-			}
-
-			_, err = w.Write(data)
-			if err != nil {
-				return fmt.Errorf("failed to write data: %w", err)
-			}
-
-			return nil
-		})
-
-		if err != nil {
-			log.Error("failed to access data", "error", err)
-			http.Error(w, "failed to access data", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err == statemate.ErrNotFound {
-		http.Error(w, "not found", http.StatusNotFound)
+	maxBytes, err := parseUintQuery(r, "maxBytes", math.MaxUint64)
+	if err != nil {
+		log.Error("failed to parse maxBytes", "error", err)
+		http.Error(w, "invalid maxBytes", http.StatusBadRequest)
 		return
 	}
+
+	d.writePage(w, r, log, index, count, maxBytes)
 }
@@ -2,9 +2,12 @@ package dataset_test
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net/http"
 	"testing"
 
+	"github.com/draganm/linear/dataset"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/require"
 )
@@ -35,3 +38,138 @@ func TestGetBatch(t *testing.T) {
 			res.Body())
 	})
 }
+
+func TestGetBatchFiltered(t *testing.T) {
+	t.Parallel()
+	withDataset(t, func(ctx context.Context, url string) {
+
+		res, err := resty.New().R().SetBody([]byte{1, 2, 3}).Put(url + "/dataset/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte{4, 5, 6}).Put(url + "/dataset/1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte{1, 7}).Put(url + "/dataset/2")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		res, err = resty.New().R().SetQueryParam("prefix", "04").Get(url + "/dataset/0/3")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(
+			t, []byte{
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3,
+				0x4, 0x5, 0x6},
+			res.Body())
+		require.Equal(t, "3", res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+
+		res, err = resty.New().R().SetQueryParam("prefix", "zz").Get(url + "/dataset/0/3")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+	})
+}
+
+func TestGetBatchPaging(t *testing.T) {
+	t.Parallel()
+	withDataset(t, func(ctx context.Context, url string) {
+
+		for i, d := range [][]byte{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}} {
+			res, err := resty.New().R().SetBody(d).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+		}
+
+		res, err := resty.New().R().Get(url + "/dataset/1/18446744073709551615")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Len(t, res.Body(), 38)
+		require.Equal(t, "2", res.Header().Get(dataset.LastIndexHeader))
+		require.Equal(t, "3", res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+
+		res, err = resty.New().R().SetQueryParam("maxBytes", "20").Get(url + "/dataset/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(
+			t, []byte{
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3,
+				0x1, 0x2, 0x3},
+			res.Body())
+		require.Equal(t, "1", res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+
+		res, err = resty.New().R().SetQueryParam("limit", "2").Get(url + "/dataset/1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Len(t, res.Body(), 38)
+		require.Equal(t, "3", res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+
+		res, err = resty.New().R().Get(url + "/dataset/3/2")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode())
+	})
+}
+
+func TestGetBatchReverse(t *testing.T) {
+	t.Parallel()
+	withDataset(t, func(ctx context.Context, url string) {
+
+		for i, d := range [][]byte{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}} {
+			res, err := resty.New().R().SetBody(d).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+		}
+
+		res, err := resty.New().R().SetQueryParam("order", "desc").Get(url + "/dataset/last/2")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, "desc", res.Header().Get(dataset.OrderHeader))
+		require.Equal(
+			t, []byte{
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3,
+				0x7, 0x8, 0x9,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3,
+				0x4, 0x5, 0x6},
+			res.Body())
+		require.Equal(t, "0", res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+
+		res, err = resty.New().R().SetQueryParam("order", "desc").Get(url + "/dataset/0/100")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Len(t, res.Body(), 19)
+		require.Empty(t, res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+	})
+}
+
+func TestGetBatchHighIndexes(t *testing.T) {
+	t.Parallel()
+	withDataset(t, func(ctx context.Context, url string) {
+		first := uint64(math.MaxUint64 - 10)
+
+		for i := first; i < math.MaxUint64; i++ {
+			res, err := resty.New().R().SetBody([]byte{byte(i)}).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+		}
+
+		res, err := resty.New().R().SetBody([]byte{0}).Put(fmt.Sprintf("%s/dataset/%d", url, uint64(math.MaxUint64)))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+
+		res, err = resty.New().R().Get(fmt.Sprintf("%s/dataset/%d/%d", url, first, uint64(math.MaxUint64)))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Len(t, res.Body(), 10*17)
+		require.Equal(t, fmt.Sprint(uint64(math.MaxUint64)), res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+
+		res, err = resty.New().R().SetQueryParam("order", "desc").Get(fmt.Sprintf("%s/dataset/%d/%d", url, uint64(math.MaxUint64-1), uint64(math.MaxUint64)))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Len(t, res.Body(), 10*17)
+		require.Equal(t, fmt.Sprint(first-1), res.RawResponse.Trailer.Get(dataset.NextIndexTrailer))
+	})
+}
@@ -0,0 +1,85 @@
+package dataset
+
+import (
+	"context"
+	"net/http"
+)
+
+func (d *Dataset) GetByKey(w http.ResponseWriter, r *http.Request) {
+	r, span := d.startSpan(r, "dataset.GetByKey")
+	defer span.End()
+
+	log := d.log.With("method", r.Method, "path", r.URL.Path)
+
+	key := r.PathValue("key")
+
+	if key == "" {
+		log.Error("key not provided")
+		http.Error(w, "key not provided", http.StatusBadRequest)
+		return
+	}
+
+	if d.keyExtractor == nil {
+		log.Error("dataset has no key extractor")
+		http.Error(w, "dataset has no key extractor", http.StatusBadRequest)
+		return
+	}
+
+	// the archiver archives the sealed head before dropping its keys and then the head, so with
+	// the heads held and their keys looked up before the bounds, entries up to archivedLast are in
+	// the archive and the later ones in the held heads
+	h, release := d.acquireHeads()
+	defer release()
+
+	headIndexes := d.lookupHeadKey(key)
+	_, archivedLast, isArchived := d.archive.Bounds()
+
+	archived, err := d.archive.LookupKey(r.Context(), key)
+	if err != nil {
+		log.Error("failed to look up key in archive", "error", err)
+		failSpan(r, err)
+		http.Error(w, "failed to look up key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	for _, i := range archived {
+		if !isArchived || i > archivedLast {
+			// archived after the bounds were taken, written from the heads
+			break
+		}
+
+		err = d.archive.Read(r.Context(), i, 1, func(ctx context.Context, index uint64, data []byte) error {
+			return writeEntry(w, index, data)
+		})
+		if err != nil {
+			log.Error("failed to access archived data", "error", err)
+			failSpan(r, err)
+			return
+		}
+	}
+
+	headLast, hasHead := h.last()
+
+	for _, i := range headIndexes {
+		if isArchived && i <= archivedLast {
+			// already written from the archive
+			continue
+		}
+
+		if !hasHead || i > headLast {
+			// appended to a head that is not held
+			break
+		}
+
+		err = h.read(i, func(data []byte) error {
+			return writeEntry(w, i, data)
+		})
+		if err != nil {
+			log.Error("failed to access data", "error", err)
+			failSpan(r, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package dataset_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/keyindex"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetByKey(t *testing.T) {
+	t.Parallel()
+	config := dataset.DatasetConfig{
+		MaxArchiveSize: 100,
+		MaxArchiveTime: 24 * time.Hour,
+		KeyExtractor: &keyindex.Config{
+			ByteRange: &keyindex.ByteRange{Offset: 0, Length: 1},
+		},
+	}
+	withDatasetConfig(t, config, func(ctx context.Context, url string) {
+
+		res, err := resty.New().R().SetBody([]byte{1, 2}).Put(url + "/dataset/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte{2, 3}).Put(url + "/dataset/1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte{1, 4}).Put(url + "/dataset/2")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		res, err = resty.New().R().Get(url + "/dataset/by-key/01")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(
+			t, []byte{
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2,
+				0x1, 0x2,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2,
+				0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2,
+				0x1, 0x4},
+			res.Body())
+	})
+}
+
+func TestGetByKeyWhileArchiving(t *testing.T) {
+	t.Parallel()
+	config := dataset.DatasetConfig{
+		MaxArchiveSize: 1,
+		KeyExtractor: &keyindex.Config{
+			ByteRange: &keyindex.ByteRange{Offset: 0, Length: 1},
+		},
+	}
+	withDatasetConfig(t, config, func(ctx context.Context, url string) {
+		for i := 0; i < 200; i++ {
+			res, err := resty.New().R().SetBody([]byte{1, byte(i)}).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+			// every entry appended so far is found, whether it is being archived or not
+			res, err = resty.New().R().Get(url + "/dataset/by-key/01")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+			require.Len(t, res.Body(), (i+1)*18, "after appending %d", i)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package dataset
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 )
 
@@ -14,13 +15,21 @@ type DatasetInfo struct {
 }
 
 func (d *Dataset) GetInfo(w http.ResponseWriter, r *http.Request) {
+	r, span := d.startSpan(r, "dataset.GetInfo")
+	defer span.End()
 
 	i := DatasetInfo{
 		Name:         d.name,
 		Config:       d.config,
-		FirstIndex:   d.head.GetFirstIndex(),
-		LastIndex:    d.head.GetLastIndex(),
-		StorageBytes: d.head.StorageStats().IndexSize + d.head.StorageStats().DataSize,
+		FirstIndex:   math.MaxUint64,
+		LastIndex:    math.MaxUint64,
+		StorageBytes: d.headBytes(),
+	}
+
+	first, last, ok := d.bounds()
+	if ok {
+		i.FirstIndex = first
+		i.LastIndex = last
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -28,3 +37,17 @@ func (d *Dataset) GetInfo(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(i)
 
 }
+
+// headBytes returns the size of the entries not archived yet.
+func (d *Dataset) headBytes() uint64 {
+	d.headLock.RLock()
+	defer d.headLock.RUnlock()
+
+	total := uint64(0)
+	for _, s := range []*headSegment{d.sealed, d.head} {
+		if s != nil {
+			total += s.storageBytes()
+		}
+	}
+	return total
+}
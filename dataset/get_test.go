@@ -24,3 +24,14 @@ func TestGet(t *testing.T) {
 
 	})
 }
+
+func TestGetNotFound(t *testing.T) {
+	t.Parallel()
+	withDataset(t, func(ctx context.Context, url string) {
+
+		res, err := resty.New().R().Get(url + "/dataset/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode())
+
+	})
+}
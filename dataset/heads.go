@@ -0,0 +1,166 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/draganm/statemate"
+)
+
+// headSegment is a statemate holding entries that are not archived yet.
+type headSegment struct {
+	sm   *statemate.StateMate[uint64]
+	path string
+	seq  uint64
+	// readers holds the segment open while it is read
+	readers sync.WaitGroup
+	// firstAppend is the unix time in nanoseconds of appending the oldest entry as far as
+	// this process knows, zero if the segment is empty
+	firstAppend atomic.Int64
+	// sealedAt is the unix time in nanoseconds of sealing the segment as far as this process knows,
+	// zero if it is the current head
+	sealedAt atomic.Int64
+}
+
+func openHeadSegment(dir string, seq uint64) (*headSegment, error) {
+	p := filepath.Join(dir, fmt.Sprintf("%020d", seq))
+
+	sm, err := statemate.Open[uint64](p, statemate.Options{
+		AllowGaps: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open statemate: %w", err)
+	}
+
+	s := &headSegment{
+		sm:   sm,
+		path: p,
+		seq:  seq,
+	}
+
+	if !sm.IsEmpty() {
+		s.firstAppend.Store(time.Now().UnixNano())
+	}
+
+	return s, nil
+}
+
+// openHeads opens the current head and the sealed head left over by an archiving that did not finish.
+func openHeads(dir string) (head, sealed *headSegment, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create heads dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list heads dir: %w", err)
+	}
+
+	seqs := []uint64{}
+	for _, e := range entries {
+		seq, err := strconv.ParseUint(e.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+
+	switch len(seqs) {
+	case 0:
+		head, err = openHeadSegment(dir, 0)
+		return head, nil, err
+	case 1:
+		head, err = openHeadSegment(dir, seqs[0])
+		return head, nil, err
+	case 2:
+		sealed, err = openHeadSegment(dir, seqs[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		sealed.sealedAt.Store(time.Now().UnixNano())
+		head, err = openHeadSegment(dir, seqs[1])
+		if err != nil {
+			sealed.sm.Close()
+			return nil, nil, err
+		}
+		return head, sealed, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected number of heads in %s: %d", dir, len(seqs))
+	}
+}
+
+// remove closes the segment once nobody reads it and deletes its files.
+func (s *headSegment) remove() error {
+	s.readers.Wait()
+
+	err := s.sm.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close sealed head: %w", err)
+	}
+
+	return errors.Join(os.Remove(s.path), os.Remove(s.path+".idx"))
+}
+
+func (s *headSegment) storageBytes() uint64 {
+	stats := s.sm.StorageStats()
+	return stats.IndexSize + stats.DataSize
+}
+
+// heads are the non-empty head segments in ascending index order.
+type heads []*statemate.StateMate[uint64]
+
+// acquireHeads returns the non-empty head segments, which stay open until release is called.
+func (d *Dataset) acquireHeads() (h heads, release func()) {
+	d.headLock.RLock()
+	defer d.headLock.RUnlock()
+
+	segments := []*headSegment{}
+	for _, s := range []*headSegment{d.sealed, d.head} {
+		if s == nil {
+			continue
+		}
+		s.readers.Add(1)
+		segments = append(segments, s)
+		if !s.sm.IsEmpty() {
+			h = append(h, s.sm)
+		}
+	}
+
+	return h, func() {
+		for _, s := range segments {
+			s.readers.Done()
+		}
+	}
+}
+
+func (h heads) first() (uint64, bool) {
+	if len(h) == 0 {
+		return 0, false
+	}
+	return h[0].GetFirstIndex(), true
+}
+
+func (h heads) last() (uint64, bool) {
+	if len(h) == 0 {
+		return 0, false
+	}
+	return h[len(h)-1].GetLastIndex(), true
+}
+
+func (h heads) read(index uint64, fn func(data []byte) error) error {
+	for _, sm := range h {
+		if index >= sm.GetFirstIndex() && index <= sm.GetLastIndex() {
+			return sm.Read(index, fn)
+		}
+	}
+	return statemate.ErrNotFound
+}
@@ -0,0 +1,49 @@
+package dataset
+
+import (
+	"fmt"
+)
+
+func (d *Dataset) indexHead() error {
+	if d.keyExtractor == nil {
+		return nil
+	}
+
+	h, release := d.acquireHeads()
+	defer release()
+
+	for _, sm := range h {
+		for i := sm.GetFirstIndex(); i <= sm.GetLastIndex(); i++ {
+			err := sm.Read(i, func(data []byte) error {
+				d.indexEntry(i, data)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to index head entry %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Dataset) indexEntry(index uint64, data []byte) {
+	if d.keyExtractor == nil {
+		return
+	}
+
+	k, ok := d.keyExtractor(data)
+	if !ok {
+		return
+	}
+
+	d.headKeysMu.Lock()
+	d.headKeys.Add(k, index)
+	d.headKeysMu.Unlock()
+}
+
+func (d *Dataset) lookupHeadKey(key string) []uint64 {
+	d.headKeysMu.RLock()
+	defer d.headKeysMu.RUnlock()
+	return d.headKeys.Lookup(key)
+}
@@ -0,0 +1,48 @@
+package dataset
+
+import (
+	"context"
+	"time"
+)
+
+const DefaultMaintenanceInterval = 10 * time.Minute
+
+// startMaintenance periodically compacts archived blobs and moves them to their tiers until Close is called.
+func (d *Dataset) startMaintenance(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultMaintenanceInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stopMaintenance = cancel
+	d.maintenanceDone = make(chan struct{})
+
+	go func() {
+		defer close(d.maintenanceDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if d.config.CompactionTargetSize > 0 {
+				err := d.archive.Compact(ctx, d.config.CompactionTargetSize)
+				if err != nil && ctx.Err() == nil {
+					d.log.Error("failed to compact archive", "error", err)
+				}
+			}
+
+			if len(d.config.Tiering) > 0 {
+				err := d.archive.ApplyTiering(ctx, d.config.Tiering, time.Now())
+				if err != nil && ctx.Err() == nil {
+					d.log.Error("failed to apply tiering", "error", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
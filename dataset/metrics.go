@@ -0,0 +1,185 @@
+package dataset
+
+import (
+	"errors"
+	"time"
+
+	"github.com/draganm/statemate"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type metrics struct {
+	appends        prometheus.Counter
+	appendBytes    prometheus.Counter
+	appendDuration prometheus.Histogram
+	appendErrors   *prometheus.CounterVec
+
+	headBytes             *prometheus.Desc
+	firstIndex            *prometheus.Desc
+	lastIndex             *prometheus.Desc
+	archivedLastIndex     *prometheus.Desc
+	unarchivedEntries     *prometheus.Desc
+	oldestUnarchivedAge   *prometheus.Desc
+	keyIndexCacheBytes    *prometheus.Desc
+	keyIndexCacheMaxBytes *prometheus.Desc
+}
+
+func newMetrics(name string) *metrics {
+	labels := prometheus.Labels{"dataset": name}
+
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(metric, help, nil, labels)
+	}
+
+	return &metrics{
+		appends: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "linear_dataset_appends_total",
+			Help:        "Entries appended to the dataset.",
+			ConstLabels: labels,
+		}),
+		appendBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "linear_dataset_append_bytes_total",
+			Help:        "Bytes of the entries appended to the dataset.",
+			ConstLabels: labels,
+		}),
+		appendDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "linear_dataset_append_duration_seconds",
+			Help:        "Duration of appending a single entry to the head, including failed appends.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+		appendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "linear_dataset_append_errors_total",
+			Help:        "Failed appends by error.",
+			ConstLabels: labels,
+		}, []string{"error"}),
+
+		headBytes:           desc("linear_dataset_head_bytes", "Storage size of the head segments, the entries not archived yet."),
+		firstIndex:          desc("linear_dataset_first_index", "First index of the dataset, absent when the dataset is empty."),
+		lastIndex:           desc("linear_dataset_last_index", "Last index of the dataset, absent when the dataset is empty."),
+		archivedLastIndex:   desc("linear_dataset_archived_last_index", "Last archived index, absent when nothing is archived."),
+		unarchivedEntries:   desc("linear_dataset_unarchived_entries", "Entries in the head segments waiting to be archived."),
+		oldestUnarchivedAge: desc("linear_dataset_oldest_unarchived_age_seconds", "Age of the oldest entry waiting to be archived, zero if there is none."),
+
+		keyIndexCacheBytes:    desc("linear_dataset_key_index_cache_bytes", "Size of the loaded archive key indexes."),
+		keyIndexCacheMaxBytes: desc("linear_dataset_key_index_cache_max_bytes", "Size limit of the loaded archive key indexes."),
+	}
+}
+
+// appendErrorLabel maps append errors to the error label of linear_dataset_append_errors_total.
+func appendErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, statemate.ErrIndexMustBeIncreasing):
+		return "index_must_be_increasing"
+	case errors.Is(err, statemate.ErrIndexGapsAreNotAllowed):
+		return "index_gaps_are_not_allowed"
+	case errors.Is(err, statemate.ErrNotEnoughSpace):
+		return "not_enough_space"
+	case errors.Is(err, ErrIndexOutOfRange):
+		return "index_out_of_range"
+	case errors.Is(err, ErrShuttingDown):
+		return "shutting_down"
+	default:
+		return "other"
+	}
+}
+
+func (m *metrics) observeAppend(size int, start time.Time, err error) {
+	m.appendDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		m.appendErrors.WithLabelValues(appendErrorLabel(err)).Inc()
+		return
+	}
+
+	m.appends.Inc()
+	m.appendBytes.Add(float64(size))
+}
+
+// Describe implements prometheus.Collector.
+func (d *Dataset) Describe(ch chan<- *prometheus.Desc) {
+	m := d.metrics
+
+	m.appends.Describe(ch)
+	m.appendBytes.Describe(ch)
+	m.appendDuration.Describe(ch)
+	m.appendErrors.Describe(ch)
+
+	for _, desc := range []*prometheus.Desc{
+		m.headBytes,
+		m.firstIndex,
+		m.lastIndex,
+		m.archivedLastIndex,
+		m.unarchivedEntries,
+		m.oldestUnarchivedAge,
+		m.keyIndexCacheBytes,
+		m.keyIndexCacheMaxBytes,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector, reporting the append metrics and the state of the head and the archive.
+func (d *Dataset) Collect(ch chan<- prometheus.Metric) {
+	m := d.metrics
+
+	m.appends.Collect(ch)
+	m.appendBytes.Collect(ch)
+	m.appendDuration.Collect(ch)
+	m.appendErrors.Collect(ch)
+
+	gauge := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v)
+	}
+
+	first, last, ok := d.bounds()
+	if ok {
+		gauge(m.firstIndex, float64(first))
+		gauge(m.lastIndex, float64(last))
+	}
+
+	_, archivedLast, archived := d.archive.Bounds()
+	if archived {
+		gauge(m.archivedLastIndex, float64(archivedLast))
+	}
+
+	size, maxSize := d.archive.KeyIndexCacheSize()
+	gauge(m.keyIndexCacheBytes, float64(size))
+	gauge(m.keyIndexCacheMaxBytes, float64(maxSize))
+
+	if d.readOnly {
+		return
+	}
+
+	entries, oldest := d.unarchived()
+	gauge(m.headBytes, float64(d.headBytes()))
+	gauge(m.unarchivedEntries, float64(entries))
+
+	age := 0.0
+	if !oldest.IsZero() {
+		age = time.Since(oldest).Seconds()
+	}
+	gauge(m.oldestUnarchivedAge, age)
+}
+
+// unarchived returns the number of entries in the heads and the time the oldest of them was appended,
+// as far as this process knows.
+func (d *Dataset) unarchived() (entries uint64, oldest time.Time) {
+	d.headLock.RLock()
+	defer d.headLock.RUnlock()
+
+	for _, s := range []*headSegment{d.sealed, d.head} {
+		if s == nil || s.sm.IsEmpty() {
+			continue
+		}
+
+		entries += s.sm.Count()
+
+		firstAppend := s.firstAppend.Load()
+		if firstAppend != 0 && (oldest.IsZero() || time.Unix(0, firstAppend).Before(oldest)) {
+			oldest = time.Unix(0, firstAppend)
+		}
+	}
+
+	return entries, oldest
+}
@@ -0,0 +1,125 @@
+package dataset_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/objectstore"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	log := slogt.New(t)
+	store := objectstore.NewMemory()
+	localDir := t.TempDir()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	config := dataset.DatasetConfig{
+		MaxArchiveSize: 100,
+		MaxArchiveTime: 24 * time.Hour,
+	}
+
+	ds, err := dataset.Create(ctx, dataset.CreateOptions{
+		Log:          log,
+		Store:        store,
+		Config:       config,
+		Name:         "test-dataset",
+		LocalDir:     localDir,
+		BlobmapCache: bmc,
+	})
+	require.NoError(t, err)
+
+	_, err = dataset.Create(ctx, dataset.CreateOptions{
+		Log:          log,
+		Store:        store,
+		Config:       config,
+		Name:         "test-dataset",
+		LocalDir:     t.TempDir(),
+		BlobmapCache: bmc,
+	})
+	require.ErrorIs(t, err, dataset.ErrAlreadyExists)
+
+	url := serveDataset(t, ds)
+
+	appendEntries := func(url string, from, to int) {
+		for i := from; i < to; i++ {
+			res, err := resty.New().R().SetBody([]byte(fmt.Sprintf("entry-%03d", i))).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+		}
+	}
+
+	getEntry := func(url string, i int) int {
+		res, err := resty.New().R().Get(fmt.Sprintf("%s/dataset/%d", url, i))
+		require.NoError(t, err)
+		if res.StatusCode() == http.StatusOK {
+			require.Equal(t, fmt.Sprintf("entry-%03d", i), string(res.Body()))
+		}
+		return res.StatusCode()
+	}
+
+	appendEntries(url, 0, 20)
+	require.NoError(t, ds.Close())
+
+	_, err = dataset.Open(ctx, log, dataset.OpenOptions{
+		Store:    store,
+		Name:     "missing",
+		LocalDir: t.TempDir(),
+	})
+	require.ErrorIs(t, err, dataset.ErrNotFound)
+
+	ds, err = dataset.Open(ctx, log, dataset.OpenOptions{
+		Store:        store,
+		Name:         "test-dataset",
+		LocalDir:     localDir,
+		BlobmapCache: bmc,
+	})
+	require.NoError(t, err)
+	defer ds.Close()
+
+	url = serveDataset(t, ds)
+
+	for i := 0; i < 20; i++ {
+		require.Equal(t, http.StatusOK, getEntry(url, i))
+	}
+
+	appendEntries(url, 20, 40)
+
+	t.Run("read-only replica", func(t *testing.T) {
+		replica, err := dataset.Open(ctx, log, dataset.OpenOptions{
+			Store:           store,
+			Name:            "test-dataset",
+			LocalDir:        t.TempDir(),
+			BlobmapCache:    bmc,
+			ReadOnly:        true,
+			RefreshInterval: 10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		defer replica.Close()
+
+		replicaURL := serveDataset(t, replica)
+
+		require.Equal(t, http.StatusOK, getEntry(replicaURL, 0))
+
+		res, err := resty.New().R().SetBody([]byte("x")).Put(replicaURL + "/dataset/40")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode())
+
+		require.Eventually(t, func() bool {
+			return getEntry(replicaURL, 35) == http.StatusOK
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,166 @@
+package dataset
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/draganm/linear/filter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// NextIndexTrailer is sent after a batch and holds the index following the last scanned entry.
+	// Clients continue paging or resume a filtered scan from it.
+	NextIndexTrailer = "Linear-Next-Index"
+	// LastIndexHeader holds the last index of the dataset at the time the batch was started.
+	LastIndexHeader = "Linear-Last-Index"
+	// OrderHeader is set to desc when entries are sent in descending order.
+	OrderHeader = "Linear-Order"
+)
+
+// LastIndex can be used in place of an index to refer to the current last entry of the dataset.
+const LastIndex = "last"
+
+// Server side limits of a single batch response, clients continue from NextIndexTrailer.
+const (
+	MaxPageEntries = 100_000
+	MaxPageBytes   = 64 * 1024 * 1024
+)
+
+var errPageFull = errors.New("page is full")
+
+var errEmptyDataset = errors.New("dataset is empty")
+
+// parseIndex parses an index path value, resolving LastIndex to the current last index.
+func (d *Dataset) parseIndex(indexString string) (uint64, error) {
+	if indexString == LastIndex {
+		_, last, ok := d.bounds()
+		if !ok {
+			return 0, errEmptyDataset
+		}
+		return last, nil
+	}
+
+	return strconv.ParseUint(indexString, 10, 64)
+}
+
+func parseUintQuery(r *http.Request, name string, defaultValue uint64) (uint64, error) {
+	if !r.URL.Query().Has(name) {
+		return defaultValue, nil
+	}
+	return strconv.ParseUint(r.URL.Query().Get(name), 10, 64)
+}
+
+// writePage streams up to count entries starting at index, stopping at the last index of the dataset
+// or when maxBytes of framed entries have been written. At least one entry is written if index exists.
+// With order=desc entries are streamed from index downwards and stop at the first index of the dataset.
+func (d *Dataset) writePage(
+	w http.ResponseWriter,
+	r *http.Request,
+	log *slog.Logger,
+	index, count, maxBytes uint64,
+) {
+	match, err := filter.FromQuery(r.URL.Query())
+	if err != nil {
+		log.Error("failed to parse filter", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order := r.URL.Query().Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		log.Error("invalid order", "order", order)
+		http.Error(w, "invalid order", http.StatusBadRequest)
+		return
+	}
+
+	reverse := order == "desc"
+
+	first, last, ok := d.bounds()
+	if !ok || index < first || index > last {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	read := d.readRange
+	if reverse {
+		if index-first < count {
+			count = index - first + 1
+		}
+		read = d.readRangeReverse
+	} else if last-index < count {
+		count = last - index + 1
+	}
+	count = min(count, MaxPageEntries)
+	maxBytes = min(maxBytes, MaxPageBytes)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", NextIndexTrailer)
+	w.Header().Set(LastIndexHeader, strconv.FormatUint(last, 10))
+	if reverse {
+		w.Header().Set(OrderHeader, "desc")
+	}
+
+	next := index
+	hasNext := true
+	written := uint64(0)
+	entries := 0
+
+	// time spent writing to the client, telling slow clients apart from slow reads
+	writing := time.Duration(0)
+
+	defer func() {
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.Int("linear.entries", entries),
+			attribute.Int64("linear.bytes", int64(written)),
+			attribute.Float64("linear.write_seconds", writing.Seconds()),
+		)
+	}()
+
+	err = read(r.Context(), index, count, func(i uint64, data []byte) error {
+		if match == nil || match(data) {
+			size := uint64(16 + len(data))
+			if written > 0 && written+size > maxBytes {
+				return errPageFull
+			}
+
+			start := time.Now()
+			err := writeEntry(w, i, data)
+			writing += time.Since(start)
+			if err != nil {
+				return err
+			}
+			written += size
+			entries++
+		}
+
+		switch {
+		case !reverse && i == math.MaxUint64, reverse && i == 0:
+			hasNext = false
+		case !reverse:
+			next = i + 1
+		default:
+			next = i - 1
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errPageFull) {
+		log.Error("failed to access data", "error", err)
+		failSpan(r, err)
+		if written == 0 {
+			http.Error(w, "failed to access data", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// a scan that reached either end of the index space has nothing left to fetch
+	if hasNext {
+		w.Header().Set(NextIndexTrailer, strconv.FormatUint(next, 10))
+	}
+}
@@ -0,0 +1,111 @@
+package dataset
+
+import (
+	"context"
+)
+
+// readRange reads entries in [from, from+count), archived entries first and then the heads.
+func (d *Dataset) readRange(
+	ctx context.Context,
+	from, count uint64,
+	fn func(index uint64, data []byte) error,
+) error {
+	if count == 0 {
+		return nil
+	}
+
+	h, release := d.acquireHeads()
+	defer release()
+
+	headFirst, inHeads := h.first()
+
+	if !inHeads || from < headFirst {
+		archivedCount := count
+		if inHeads && headFirst-from < count {
+			archivedCount = headFirst - from
+		}
+
+		err := d.archive.Read(ctx, from, archivedCount, func(ctx context.Context, index uint64, data []byte) error {
+			return fn(index, data)
+		})
+		if err != nil {
+			return err
+		}
+
+		from += archivedCount
+		count -= archivedCount
+	}
+
+	for n := uint64(0); n < count; n++ {
+		i := from + n
+		err := h.read(i, func(data []byte) error {
+			return fn(i, data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bounds returns the first and the last index stored in the archive or the heads.
+func (d *Dataset) bounds() (first, last uint64, ok bool) {
+	h, release := d.acquireHeads()
+	defer release()
+
+	archiveFirst, archiveLast, archived := d.archive.Bounds()
+
+	headFirst, inHeads := h.first()
+	if !inHeads {
+		return archiveFirst, archiveLast, archived
+	}
+
+	headLast, _ := h.last()
+
+	if archived {
+		return min(archiveFirst, headFirst), max(archiveLast, headLast), true
+	}
+
+	return headFirst, headLast, true
+}
+
+// readRangeReverse reads entries in [to-count+1, to] in descending order, head entries first and then the archive.
+func (d *Dataset) readRangeReverse(
+	ctx context.Context,
+	to, count uint64,
+	fn func(index uint64, data []byte) error,
+) error {
+	if count == 0 {
+		return nil
+	}
+
+	h, release := d.acquireHeads()
+	defer release()
+
+	headFirst, inHeads := h.first()
+
+	if inHeads {
+		for ; count > 0 && to >= headFirst; count-- {
+			err := h.read(to, func(data []byte) error {
+				return fn(to, data)
+			})
+			if err != nil {
+				return err
+			}
+
+			if to == 0 {
+				return nil
+			}
+			to--
+		}
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	return d.archive.ReadReverse(ctx, to, count, func(ctx context.Context, index uint64, data []byte) error {
+		return fn(index, data)
+	})
+}
@@ -0,0 +1,174 @@
+package dataset_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/objectstore"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledStore blocks uploads of blobs until their context is done.
+type stalledStore struct {
+	objectstore.Store
+}
+
+func (s stalledStore) Put(ctx context.Context, key string, r io.Reader) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// stalledWriter blocks the first write of a response until release is closed.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	once    sync.Once
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.writing)
+		<-w.release
+	})
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	bmc, err := blobmapcache.Open(t.TempDir(), 50*1024*1024)
+	require.NoError(t, err)
+	defer bmc.Close()
+
+	create := func(t *testing.T, store objectstore.Store, localDir string, config dataset.DatasetConfig) (*dataset.Dataset, string) {
+		ds, err := dataset.Create(ctx, dataset.CreateOptions{
+			Log:          slogt.New(t),
+			Store:        store,
+			Config:       config,
+			Name:         "test-dataset",
+			LocalDir:     localDir,
+			BlobmapCache: bmc,
+		})
+		require.NoError(t, err)
+		return ds, serveDataset(t, ds)
+	}
+
+	reopen := func(t *testing.T, store objectstore.Store, localDir string) string {
+		ds, err := dataset.Open(ctx, slogt.New(t), dataset.OpenOptions{
+			Store:        store,
+			Name:         "test-dataset",
+			LocalDir:     localDir,
+			BlobmapCache: bmc,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { ds.Close() })
+		return serveDataset(t, ds)
+	}
+
+	appendEntries := func(t *testing.T, url string, count int) {
+		for i := 0; i < count; i++ {
+			res, err := resty.New().R().SetBody([]byte(fmt.Sprintf("entry-%03d", i))).Put(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNoContent, res.StatusCode())
+		}
+	}
+
+	requireEntries := func(t *testing.T, url string, count int) {
+		for i := 0; i < count; i++ {
+			res, err := resty.New().R().Get(fmt.Sprintf("%s/dataset/%d", url, i))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+			require.Equal(t, fmt.Sprintf("entry-%03d", i), res.String())
+		}
+	}
+
+	t.Run("archives the head", func(t *testing.T) {
+		store := objectstore.NewMemory()
+
+		ds, url := create(t, store, t.TempDir(), dataset.DatasetConfig{MaxArchiveTime: 24 * time.Hour})
+		appendEntries(t, url, 5)
+
+		require.NoError(t, ds.Shutdown(ctx, dataset.ShutdownOptions{ArchiveHead: true}))
+
+		res, err := resty.New().R().SetBody([]byte("late")).Put(url + "/dataset/5")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+
+		blobs, err := store.List(ctx, "test-dataset/blobs/")
+		require.NoError(t, err)
+		require.Len(t, blobs, 1)
+		require.Equal(t, "test-dataset/blobs/blob-00000000000000000000-00000000000000000004", blobs[0].Key)
+
+		// without the local heads, the entries can only come from the archive
+		requireEntries(t, reopen(t, store, t.TempDir()), 5)
+	})
+
+	t.Run("gives up archiving at the deadline", func(t *testing.T) {
+		store := stalledStore{objectstore.NewMemory()}
+		localDir := t.TempDir()
+
+		ds, url := create(t, store, localDir, dataset.DatasetConfig{MaxArchiveSize: 1})
+		appendEntries(t, url, 5)
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		require.NoError(t, ds.Shutdown(shutdownCtx, dataset.ShutdownOptions{}))
+
+		requireEntries(t, reopen(t, store, localDir), 5)
+	})
+	t.Run("waits for reads in flight", func(t *testing.T) {
+		ds, url := create(t, objectstore.NewMemory(), t.TempDir(), dataset.DatasetConfig{MaxArchiveTime: 24 * time.Hour})
+		appendEntries(t, url, 5)
+
+		w := &stalledWriter{
+			ResponseRecorder: httptest.NewRecorder(),
+			writing:          make(chan struct{}),
+			release:          make(chan struct{}),
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/dataset/0/5", nil)
+		req.SetPathValue("index", "0")
+		req.SetPathValue("count", "5")
+
+		served := make(chan struct{})
+		go func() {
+			defer close(served)
+			ds.GetBatch(w, req)
+		}()
+
+		// the read holds the head while it writes the first entry
+		<-w.writing
+
+		shutDown := make(chan error, 1)
+		go func() {
+			shutDown <- ds.Shutdown(ctx, dataset.ShutdownOptions{})
+		}()
+
+		select {
+		case <-shutDown:
+			t.Fatal("shutdown closed the head during a read")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(w.release)
+		<-served
+		require.NoError(t, <-shutDown)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "entry-004")
+	})
+}
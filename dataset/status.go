@@ -0,0 +1,179 @@
+package dataset
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Status is a snapshot of the state of a dataset for diagnostics.
+type Status struct {
+	Name       string  `json:"name"`
+	ReadOnly   bool    `json:"read_only"`
+	FirstIndex *uint64 `json:"first_index,omitempty"`
+	LastIndex  *uint64 `json:"last_index,omitempty"`
+	// ArchivedLastIndex is the last index readable from the archive.
+	ArchivedLastIndex *uint64 `json:"archived_last_index,omitempty"`
+	ArchivedBlobs     int     `json:"archived_blobs"`
+	ArchivedBytes     uint64  `json:"archived_bytes"`
+	HeadBytes         uint64  `json:"head_bytes"`
+	UnarchivedEntries uint64  `json:"unarchived_entries"`
+	// Sealed is set while a sealed head waits to be archived.
+	Sealed bool `json:"sealed"`
+	// ArchiverLagSeconds is how long archiving has been overdue, see ArchiverLag.
+	ArchiverLagSeconds float64    `json:"archiver_lag_seconds"`
+	OldestUnarchived   *time.Time `json:"oldest_unarchived,omitempty"`
+	LastArchived       *time.Time `json:"last_archived,omitempty"`
+	LastArchiveError   string     `json:"last_archive_error,omitempty"`
+}
+
+// Status returns the current state of the dataset.
+func (d *Dataset) Status() Status {
+	s := Status{
+		Name:          d.name,
+		ReadOnly:      d.readOnly,
+		ArchivedBlobs: len(d.archive.Blobs()),
+		ArchivedBytes: d.archive.ArchivedBytes(),
+	}
+
+	first, last, ok := d.bounds()
+	if ok {
+		s.FirstIndex = &first
+		s.LastIndex = &last
+	}
+
+	_, archivedLast, archived := d.archive.Bounds()
+	if archived {
+		s.ArchivedLastIndex = &archivedLast
+	}
+
+	if d.readOnly {
+		return s
+	}
+
+	s.HeadBytes = d.headBytes()
+	s.ArchiverLagSeconds = d.ArchiverLag().Seconds()
+
+	entries, oldest := d.unarchived()
+	s.UnarchivedEntries = entries
+	if !oldest.IsZero() {
+		s.OldestUnarchived = &oldest
+	}
+
+	d.headLock.RLock()
+	s.Sealed = d.sealed != nil
+	d.headLock.RUnlock()
+
+	d.archiverMu.Lock()
+	if !d.lastArchived.IsZero() {
+		lastArchived := d.lastArchived
+		s.LastArchived = &lastArchived
+	}
+	if d.archiveErr != nil {
+		s.LastArchiveError = d.archiveErr.Error()
+	}
+	d.archiverMu.Unlock()
+
+	return s
+}
+
+// Usage is the storage used by a dataset.
+type Usage struct {
+	ArchivedBytes uint64
+	HeadBytes     uint64
+}
+
+// Usage returns the storage used by the dataset, the head is not counted for read-only datasets.
+func (d *Dataset) Usage() Usage {
+	u := Usage{ArchivedBytes: d.archive.ArchivedBytes()}
+	if !d.readOnly {
+		u.HeadBytes = d.headBytes()
+	}
+	return u
+}
+
+// Backlog is the part of the head of a dataset waiting to be archived.
+type Backlog struct {
+	Bytes   uint64
+	Entries uint64
+}
+
+// Backlog returns the size of the head, it is empty for read-only datasets.
+func (d *Dataset) Backlog() Backlog {
+	if d.readOnly {
+		return Backlog{}
+	}
+
+	entries, _ := d.unarchived()
+	return Backlog{Bytes: d.headBytes(), Entries: entries}
+}
+
+// ArchiverLag returns how long archiving has been overdue: the time since the head was sealed
+// if the sealed head is not archived yet, or the time the oldest head entry has exceeded
+// MaxArchiveTime. It is zero for read-only datasets.
+func (d *Dataset) ArchiverLag() time.Duration {
+	if d.readOnly {
+		return 0
+	}
+
+	d.headLock.RLock()
+	defer d.headLock.RUnlock()
+
+	lag := time.Duration(0)
+
+	if d.sealed != nil {
+		sealedAt := d.sealed.sealedAt.Load()
+		if sealedAt != 0 {
+			lag = time.Since(time.Unix(0, sealedAt))
+		}
+	}
+
+	firstAppend := d.head.firstAppend.Load()
+	if d.config.MaxArchiveTime > 0 && firstAppend != 0 {
+		lag = max(lag, time.Since(time.Unix(0, firstAppend))-d.config.MaxArchiveTime)
+	}
+
+	return max(lag, 0)
+}
+
+// CheckReady checks that the head can be written and that the archiver is not lagging more
+// than lagBudget behind. Read-only datasets are always ready.
+func (d *Dataset) CheckReady(lagBudget time.Duration) error {
+	if d.readOnly {
+		return nil
+	}
+
+	err := d.checkHeadWritable()
+	if err != nil {
+		return err
+	}
+
+	lag := d.ArchiverLag()
+	if lag > lagBudget {
+		return fmt.Errorf("archiver is %s behind, more than the budget of %s", lag.Round(time.Second), lagBudget)
+	}
+
+	return nil
+}
+
+// checkHeadWritable writes and syncs a file next to the head segments.
+func (d *Dataset) checkHeadWritable() error {
+	f, err := os.CreateTemp(d.headsDir, ".writable-")
+	if err != nil {
+		return fmt.Errorf("head is not writable: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = f.Write([]byte{0})
+	if err != nil {
+		return fmt.Errorf("head is not writable: %w", err)
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("head is not writable: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package dataset
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/draganm/linear/dataset")
+
+// startSpan starts the span of a handler as a child of the span in the request context,
+// returning the request carrying the new span.
+func (d *Dataset) startSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	ctx, span := tracer.Start(r.Context(), name, trace.WithAttributes(attribute.String("linear.dataset", d.name)))
+	return r.WithContext(ctx), span
+}
+
+// failSpan marks the span in the request context as failed.
+func failSpan(r *http.Request, err error) {
+	span := trace.SpanFromContext(r.Context())
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
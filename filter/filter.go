@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"github.com/draganm/linear/keyindex"
+)
+
+// Filter reports whether an entry should be emitted.
+type Filter func(data []byte) bool
+
+// FromQuery builds a filter from the query parameters of a request.
+// Supported parameters are prefix (hex encoded byte prefix) and
+// field together with value (JSON pointer and the value it must reference).
+// All given conditions must match. Returns nil if no filter parameters are present.
+func FromQuery(q url.Values) (Filter, error) {
+	filters := []Filter{}
+
+	if q.Has("prefix") {
+		prefix, err := hex.DecodeString(q.Get("prefix"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix: %w", err)
+		}
+		filters = append(filters, Prefix(prefix))
+	}
+
+	if q.Has("field") != q.Has("value") {
+		return nil, fmt.Errorf("field and value must be provided together")
+	}
+
+	if q.Has("field") {
+		f, err := FieldEquals(q.Get("field"), q.Get("value"))
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return filters[0], nil
+	default:
+		return All(filters...), nil
+	}
+}
+
+func Prefix(prefix []byte) Filter {
+	return func(data []byte) bool {
+		return bytes.HasPrefix(data, prefix)
+	}
+}
+
+// FieldEquals matches JSON entries where the value referenced by the pointer equals value.
+// Values are compared the same way keys are extracted by keyindex.JSONPointer.
+func FieldEquals(pointer, value string) (Filter, error) {
+	ex, err := keyindex.JSONPointer(pointer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field: %w", err)
+	}
+
+	return func(data []byte) bool {
+		v, ok := ex(data)
+		return ok && v == value
+	}, nil
+}
+
+func All(filters ...Filter) Filter {
+	return func(data []byte) bool {
+		for _, f := range filters {
+			if !f(data) {
+				return false
+			}
+		}
+		return true
+	}
+}
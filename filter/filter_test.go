@@ -0,0 +1,52 @@
+package filter_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/draganm/linear/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromQuery(t *testing.T) {
+	t.Run("no filter", func(t *testing.T) {
+		f, err := filter.FromQuery(url.Values{})
+		require.NoError(t, err)
+		require.Nil(t, f)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		f, err := filter.FromQuery(url.Values{"prefix": {"0102"}})
+		require.NoError(t, err)
+		require.True(t, f([]byte{1, 2, 3}))
+		require.False(t, f([]byte{1, 3}))
+		require.False(t, f([]byte{1}))
+	})
+
+	t.Run("field", func(t *testing.T) {
+		f, err := filter.FromQuery(url.Values{"field": {"/customer"}, "value": {"x"}})
+		require.NoError(t, err)
+		require.True(t, f([]byte(`{"customer":"x"}`)))
+		require.False(t, f([]byte(`{"customer":"y"}`)))
+		require.False(t, f([]byte(`not json`)))
+	})
+
+	t.Run("prefix and field", func(t *testing.T) {
+		f, err := filter.FromQuery(url.Values{"prefix": {"7b"}, "field": {"/n"}, "value": {"1"}})
+		require.NoError(t, err)
+		require.True(t, f([]byte(`{"n":1}`)))
+		require.False(t, f([]byte(` {"n":1}`)))
+		require.False(t, f([]byte(`{"n":2}`)))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := filter.FromQuery(url.Values{"prefix": {"zz"}})
+		require.Error(t, err)
+
+		_, err = filter.FromQuery(url.Values{"field": {"/a"}})
+		require.Error(t, err)
+
+		_, err = filter.FromQuery(url.Values{"field": {"a"}, "value": {"1"}})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,140 @@
+package keyindex
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	JSONPointer string     `json:"json_pointer,omitempty"`
+	ByteRange   *ByteRange `json:"byte_range,omitempty"`
+}
+
+type ByteRange struct {
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+}
+
+// Extractor returns the application key of an entry and whether the entry has one.
+type Extractor func(data []byte) (string, bool)
+
+func (c *Config) Extractor() (Extractor, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	switch {
+	case c.JSONPointer != "" && c.ByteRange != nil:
+		return nil, errors.New("only one of json_pointer and byte_range can be set")
+	case c.JSONPointer != "":
+		return JSONPointer(c.JSONPointer)
+	case c.ByteRange != nil:
+		if c.ByteRange.Length == 0 {
+			return nil, errors.New("byte_range length must be greater than 0")
+		}
+		if c.ByteRange.Offset > math.MaxUint64-c.ByteRange.Length {
+			return nil, errors.New("byte_range offset plus length overflows")
+		}
+		return ByteRangeExtractor(c.ByteRange.Offset, c.ByteRange.Length), nil
+	default:
+		return nil, errors.New("key extractor has neither json_pointer nor byte_range")
+	}
+}
+
+// JSONPointer extracts the value referenced by an RFC 6901 pointer.
+// String values are used as they are, other scalar values are used in their JSON form.
+func JSONPointer(pointer string) (Extractor, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("json pointer %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+
+	return func(data []byte) (string, bool) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+
+		var v any
+		err := dec.Decode(&v)
+		if err != nil {
+			return "", false
+		}
+
+		for _, t := range tokens {
+			switch tv := v.(type) {
+			case map[string]any:
+				var ok bool
+				v, ok = tv[t]
+				if !ok {
+					return "", false
+				}
+			case []any:
+				i, err := strconv.ParseUint(t, 10, 64)
+				if err != nil || i >= uint64(len(tv)) {
+					return "", false
+				}
+				v = tv[i]
+			default:
+				return "", false
+			}
+		}
+
+		switch tv := v.(type) {
+		case string:
+			return tv, true
+		case json.Number:
+			return tv.String(), true
+		case bool:
+			return strconv.FormatBool(tv), true
+		default:
+			return "", false
+		}
+	}, nil
+}
+
+// ByteRangeExtractor extracts a fixed byte range of the entry, hex encoded.
+// Entries shorter than the range have no key.
+func ByteRangeExtractor(offset, length uint64) Extractor {
+	return func(data []byte) (string, bool) {
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return "", false
+		}
+		return hex.EncodeToString(data[offset : offset+length]), true
+	}
+}
+
+// Index maps application keys to the indexes of the entries having them.
+type Index map[string][]uint64
+
+func (i Index) Add(key string, index uint64) {
+	i[key] = append(i[key], index)
+}
+
+func (i Index) Lookup(key string) []uint64 {
+	indexes := slices.Clone(i[key])
+	slices.Sort(indexes)
+	return indexes
+}
+
+func (i Index) Marshal() ([]byte, error) {
+	return json.Marshal(i)
+}
+
+func Unmarshal(data []byte) (Index, error) {
+	idx := Index{}
+	err := json.Unmarshal(data, &idx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key index: %w", err)
+	}
+	return idx, nil
+}
@@ -0,0 +1,77 @@
+package keyindex_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/draganm/linear/keyindex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPointer(t *testing.T) {
+	ex, err := keyindex.JSONPointer("/customer/id")
+	require.NoError(t, err)
+
+	k, ok := ex([]byte(`{"customer":{"id":"abc"}}`))
+	require.True(t, ok)
+	require.Equal(t, "abc", k)
+
+	k, ok = ex([]byte(`{"customer":{"id":42}}`))
+	require.True(t, ok)
+	require.Equal(t, "42", k)
+
+	_, ok = ex([]byte(`{"customer":{}}`))
+	require.False(t, ok)
+
+	_, ok = ex([]byte{1, 2, 3})
+	require.False(t, ok)
+
+	ex, err = keyindex.JSONPointer("/items/1/a~1b")
+	require.NoError(t, err)
+
+	k, ok = ex([]byte(`{"items":[{},{"a/b":true}]}`))
+	require.True(t, ok)
+	require.Equal(t, "true", k)
+
+	_, err = keyindex.JSONPointer("customer")
+	require.Error(t, err)
+}
+
+func TestByteRange(t *testing.T) {
+	ex := keyindex.ByteRangeExtractor(1, 2)
+
+	k, ok := ex([]byte{1, 2, 3})
+	require.True(t, ok)
+	require.Equal(t, "0203", k)
+
+	_, ok = ex([]byte{1, 2})
+	require.False(t, ok)
+}
+
+func TestByteRangeHugeOffset(t *testing.T) {
+	ex := keyindex.ByteRangeExtractor(math.MaxUint64, 2)
+
+	_, ok := ex([]byte{1, 2, 3})
+	require.False(t, ok)
+
+	cfg := &keyindex.Config{ByteRange: &keyindex.ByteRange{Offset: math.MaxUint64, Length: 2}}
+	_, err := cfg.Extractor()
+	require.Error(t, err)
+}
+
+func TestIndex(t *testing.T) {
+	idx := keyindex.Index{}
+	idx.Add("a", 3)
+	idx.Add("a", 1)
+	idx.Add("b", 2)
+
+	d, err := idx.Marshal()
+	require.NoError(t, err)
+
+	idx2, err := keyindex.Unmarshal(d)
+	require.NoError(t, err)
+
+	require.Equal(t, []uint64{1, 3}, idx2.Lookup("a"))
+	require.Equal(t, []uint64{2}, idx2.Lookup("b"))
+	require.Empty(t, idx2.Lookup("c"))
+}
@@ -0,0 +1,78 @@
+package lead
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/draganm/linear/auth"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// authenticate returns the identity of the client, responding with 401 if it can't be authenticated.
+// Without an Authenticator every request is let through with an empty identity.
+func (l *Lead) authenticate(w http.ResponseWriter, r *http.Request) (auth.Identity, bool) {
+	if l.cfg.Authenticator == nil {
+		return auth.Identity{}, true
+	}
+
+	id, err := l.cfg.Authenticator.Authenticate(r)
+	if err != nil {
+		if !errors.Is(err, auth.ErrNoCredentials) {
+			l.log.Warn("failed to authenticate request", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="linear"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return auth.Identity{}, false
+	}
+
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("linear.subject", id.Subject),
+		attribute.String("linear.auth_method", id.Method),
+	)
+
+	return id, true
+}
+
+// authorize authenticates the request and checks that the client has perm on the dataset,
+// responding with 401 or 403 if not. The returned request carries the identity of the client.
+func (l *Lead) authorize(w http.ResponseWriter, r *http.Request, name string, perm auth.Permission) (*http.Request, bool) {
+	id, ok := l.authenticate(w, r)
+	if !ok {
+		return r, false
+	}
+
+	if l.cfg.Authenticator == nil {
+		return r, true
+	}
+
+	err := l.cfg.Policy.Authorize(id.Subject, name, perm)
+	if err != nil {
+		l.log.Warn("request denied", "method", r.Method, "path", r.URL.Path, "error", err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return r, false
+	}
+
+	return r.WithContext(auth.NewContext(r.Context(), id)), true
+}
+
+// forLead serves h to clients with perm on auth.Lead.
+func (l *Lead) forLead(perm auth.Permission, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, ok := l.authorize(w, r, auth.Lead, perm)
+		if !ok {
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// canSee reports whether the client can read from or append to the dataset.
+func (l *Lead) canSee(id auth.Identity, name string) bool {
+	if l.cfg.Authenticator == nil {
+		return true
+	}
+
+	return l.cfg.Policy.Authorize(id.Subject, name, auth.Read) == nil ||
+		l.cfg.Policy.Authorize(id.Subject, name, auth.Append) == nil
+}
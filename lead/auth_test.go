@@ -0,0 +1,96 @@
+package lead_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+		ArchiveDir: t.TempDir(),
+		StateDir:   t.TempDir(),
+		Authenticator: auth.Chain(
+			auth.StaticTokens(map[string]string{"admin-token": "admin", "reader-token": "reader", "owner-token": "owner"}),
+			auth.HMACTokens(key),
+		),
+		Policy: auth.Policy{Grants: []auth.Grant{
+			{Subject: "admin", Datasets: []string{auth.Lead, auth.AllDatasets, "evco/*"}, Permissions: []auth.Permission{auth.Admin}},
+			{Subject: "owner", Datasets: []string{auth.AllDatasets}, Permissions: []auth.Permission{auth.Admin}},
+			{Subject: "reader", Datasets: []string{"events"}, Permissions: []auth.Permission{auth.Read}},
+			{Subject: "ingester", Datasets: []string{"ev*"}, Permissions: []auth.Permission{auth.Append}},
+		}},
+		Tenants: map[string]lead.Quota{"evco": {}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ld.Close() })
+
+	s := httptest.NewServer(ld)
+	t.Cleanup(s.Close)
+
+	as := func(token string) *resty.Request {
+		return resty.New().R().SetAuthToken(token)
+	}
+
+	ingester := auth.SignToken(key, "ingester", time.Now().Add(time.Hour))
+
+	for _, path := range []string{"/api/datasets/events", "/api/datasets/other", "/api/tenants/evco/datasets/events"} {
+		res, err := as("admin-token").SetBody(dataset.DatasetConfig{
+			MaxArchiveTime: time.Hour,
+		}).Put(s.URL + path)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, res.StatusCode())
+	}
+
+	for _, c := range []struct {
+		name   string
+		req    *resty.Request
+		method string
+		path   string
+		status int
+	}{
+		{"no credentials", resty.New().R(), http.MethodGet, "/api/datasets/events", http.StatusUnauthorized},
+		{"unknown token", as("guess"), http.MethodGet, "/api/datasets/events", http.StatusUnauthorized},
+		{"expired token", as(auth.SignToken(key, "ingester", time.Now().Add(-time.Minute))), http.MethodPut, "/api/datasets/events/0", http.StatusUnauthorized},
+		{"create without admin", as("reader-token").SetBody(dataset.DatasetConfig{}), http.MethodPut, "/api/datasets/mine", http.StatusForbidden},
+		{"append without append", as("reader-token").SetBody([]byte("entry")), http.MethodPut, "/api/datasets/events/0", http.StatusForbidden},
+		{"append", as(ingester).SetBody([]byte("entry")), http.MethodPut, "/api/datasets/events/0", http.StatusNoContent},
+		{"read without read", as(ingester), http.MethodGet, "/api/datasets/events/0", http.StatusForbidden},
+		{"read", as("reader-token"), http.MethodGet, "/api/datasets/events/0", http.StatusOK},
+		{"read other dataset", as("reader-token"), http.MethodGet, "/api/datasets/other/0", http.StatusForbidden},
+		{"append to another tenant", as(ingester).SetBody([]byte("entry")), http.MethodPut, "/api/tenants/evco/datasets/events/0", http.StatusForbidden},
+		{"debug status without admin", as("reader-token"), http.MethodGet, "/debug/status", http.StatusForbidden},
+		{"debug status as admin of the default tenant", as("owner-token"), http.MethodGet, "/debug/status", http.StatusForbidden},
+		{"debug status", as("admin-token"), http.MethodGet, "/debug/status", http.StatusOK},
+		{"health", resty.New().R(), http.MethodGet, "/healthz", http.StatusOK},
+		{"metrics without credentials", resty.New().R(), http.MethodGet, "/metrics", http.StatusUnauthorized},
+		{"metrics without read on the lead", as("owner-token"), http.MethodGet, "/metrics", http.StatusForbidden},
+		{"metrics", as("admin-token"), http.MethodGet, "/metrics", http.StatusOK},
+	} {
+		res, err := c.req.Execute(c.method, s.URL+c.path)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.status, res.StatusCode(), c.name)
+	}
+
+	names := []string{}
+	res, err := as("reader-token").SetResult(&names).Get(s.URL + "/api/datasets")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Equal(t, []string{"events"}, names)
+
+	res, err = as("admin-token").SetResult(&names).Get(s.URL + "/api/datasets")
+	require.NoError(t, err)
+	require.Equal(t, []string{"events", "other"}, names)
+}
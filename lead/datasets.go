@@ -0,0 +1,476 @@
+package lead
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/objectstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// datasetNames lists the names of the datasets of the tenant in the store. It lists the directories
+// of the tenant and looks for the dataset config in each of them, not at the objects of the datasets.
+func (l *Lead) datasetNames(ctx context.Context, tenant string) ([]string, error) {
+	prefix := ""
+	if tenant != "" {
+		prefix = tenant + "/"
+	}
+
+	dirs, err := l.store.ListDirs(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list datasets: %w", err)
+	}
+
+	names := []string{}
+	for _, name := range dirs {
+		if !datasetNameRegexp.MatchString(name) {
+			continue
+		}
+
+		// the configs are small, getting one is as cheap as listing it in every store
+		r, err := l.store.Get(ctx, prefix+name+"/dataset.json")
+		if errors.Is(err, objectstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list datasets: %w", err)
+		}
+		r.Close()
+
+		// the objects of the tenant would be mistaken for the ones of the dataset
+		_, isTenant := l.cfg.Tenants[name]
+		if tenant == "" && isTenant {
+			return nil, fmt.Errorf("dataset %s of the default tenant has the name of a tenant", name)
+		}
+
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// openDatasets lists the datasets in the store once and opens the ones not open yet.
+// Datasets failing to open stay pending.
+func (l *Lead) openDatasets(ctx context.Context) error {
+	l.mu.RLock()
+	listed := l.listed
+	l.mu.RUnlock()
+
+	if !listed {
+		qualified := []string{}
+		var err error
+
+		for _, tenant := range l.tenants() {
+			var names []string
+			names, err = l.datasetNames(ctx, tenant)
+			if err != nil {
+				break
+			}
+			for _, name := range names {
+				qualified = append(qualified, qualifiedName(tenant, name))
+			}
+		}
+
+		l.mu.Lock()
+		l.listErr = err
+		l.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		for _, name := range qualified {
+			_, open := l.datasets[name]
+			if !open && !l.creating[name] {
+				l.pending[name] = true
+			}
+		}
+		l.listed = true
+		l.mu.Unlock()
+	}
+
+	l.mu.RLock()
+	pending := slices.Sorted(maps.Keys(l.pending))
+	l.mu.RUnlock()
+
+	errs := []error{}
+
+	for _, name := range pending {
+		ds, err := l.openDataset(ctx, name)
+
+		l.mu.Lock()
+		if err != nil {
+			l.openErrs[name] = err
+			errs = append(errs, fmt.Errorf("failed to open dataset %s: %w", name, err))
+		} else {
+			l.datasets[name] = ds
+			delete(l.pending, name)
+			delete(l.openErrs, name)
+		}
+		l.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+const openRetryInterval = 10 * time.Second
+
+// openInBackground opens the datasets, retrying until all of them are open or the lead is closed.
+func (l *Lead) openInBackground() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.stopOpening = cancel
+	l.openingDone = make(chan struct{})
+
+	go func() {
+		defer close(l.openingDone)
+
+		for {
+			err := l.openDatasets(ctx)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+
+			l.log.Error("failed to open datasets", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(openRetryInterval):
+			}
+		}
+	}()
+}
+
+func (l *Lead) openDataset(ctx context.Context, name string) (*dataset.Dataset, error) {
+	return dataset.Open(ctx, l.log.With("dataset", name), dataset.OpenOptions{
+		Store:               l.store,
+		Name:                name,
+		LocalDir:            l.localDir(name),
+		BlobmapCache:        l.cache,
+		Tiers:               l.tiers,
+		MaintenanceInterval: l.cfg.MaintenanceInterval,
+		ReadOnly:            l.cfg.ReadOnly,
+		RefreshInterval:     l.cfg.RefreshInterval,
+	})
+}
+
+// localDir of the dataset with the qualified name, StateDir/<tenant>/<dataset> for datasets of tenants.
+func (l *Lead) localDir(qualified string) string {
+	tenant, name := splitQualifiedName(qualified)
+	if tenant == "" {
+		return filepath.Join(l.cfg.StateDir, "datasets", name)
+	}
+	return filepath.Join(l.cfg.StateDir, tenant, name)
+}
+
+var errDatasetOpening = errors.New("dataset is opening")
+
+// dataset returns the open dataset with the qualified name. Read-only leads open datasets created
+// after they started on first use.
+func (l *Lead) dataset(ctx context.Context, name string) (*dataset.Dataset, error) {
+	l.mu.RLock()
+	ds, ok := l.datasets[name]
+	pending := l.pending[name]
+	l.mu.RUnlock()
+
+	if ok {
+		return ds, nil
+	}
+
+	if pending {
+		return nil, errDatasetOpening
+	}
+
+	_, plain := splitQualifiedName(name)
+	if !l.cfg.ReadOnly || !datasetNameRegexp.MatchString(plain) {
+		return nil, dataset.ErrNotFound
+	}
+
+	return l.openLate(ctx, name)
+}
+
+const (
+	// missingDatasetTTL is how long read-only leads answer requests to a dataset found missing
+	// without looking it up again.
+	missingDatasetTTL = 5 * time.Second
+	// maxMissingDatasets bounds the missing datasets remembered.
+	maxMissingDatasets = 1024
+)
+
+// openLate opens a dataset created after the read-only lead started without holding l.mu, so that
+// requests to the open datasets don't wait for it. Concurrent requests to the dataset share the open.
+func (l *Lead) openLate(ctx context.Context, name string) (*dataset.Dataset, error) {
+	l.mu.Lock()
+
+	ds, ok := l.datasets[name]
+	if ok {
+		l.mu.Unlock()
+		return ds, nil
+	}
+
+	missingSince, missing := l.missing[name]
+	if missing && time.Since(missingSince) < missingDatasetTTL {
+		l.mu.Unlock()
+		return nil, dataset.ErrNotFound
+	}
+
+	open, opening := l.opening[name]
+	if !opening {
+		// the open is shared, it must not fail when the request starting it is canceled
+		ctx := context.WithoutCancel(ctx)
+
+		open = sync.OnceValues(func() (*dataset.Dataset, error) {
+			ctx, span := tracer.Start(ctx, "lead.openDataset", trace.WithAttributes(attribute.String("linear.dataset", name)))
+			defer span.End()
+
+			ds, err := l.openDataset(ctx, name)
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			delete(l.opening, name)
+
+			if errors.Is(err, dataset.ErrNotFound) {
+				l.rememberMissing(name)
+				return nil, err
+			}
+
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return nil, err
+			}
+
+			delete(l.missing, name)
+			l.datasets[name] = ds
+
+			return ds, nil
+		})
+		l.opening[name] = open
+	}
+
+	l.mu.Unlock()
+
+	return open()
+}
+
+// rememberMissing records that the dataset was found missing, l.mu must be held.
+func (l *Lead) rememberMissing(name string) {
+	if len(l.missing) >= maxMissingDatasets {
+		for n, since := range l.missing {
+			if time.Since(since) >= missingDatasetTTL {
+				delete(l.missing, n)
+			}
+		}
+	}
+
+	if len(l.missing) < maxMissingDatasets {
+		l.missing[name] = time.Now()
+	}
+}
+
+// forDataset serves requests to a dataset from clients with perm on it.
+func (l *Lead) forDataset(perm auth.Permission, handler func(*dataset.Dataset, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant, ok := l.requestTenant(w, r)
+		if !ok {
+			return
+		}
+
+		name := qualifiedName(tenant, r.PathValue("dataset"))
+
+		r, ok = l.authorize(w, r, name, perm)
+		if !ok {
+			return
+		}
+
+		if !l.startRequest() {
+			http.Error(w, "lead is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer l.requests.Done()
+
+		ds, err := l.dataset(r.Context(), name)
+		if errors.Is(err, dataset.ErrNotFound) {
+			http.Error(w, "dataset not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errDatasetOpening) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "dataset is opening", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err != nil {
+			l.log.Error("failed to open dataset", "dataset", name, "error", err)
+			http.Error(w, "failed to open dataset", http.StatusInternalServerError)
+			return
+		}
+
+		handler(ds, w, r)
+	}
+}
+
+// startRequest tracks a dataset request unless the lead is shutting down.
+func (l *Lead) startRequest() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.shuttingDown {
+		return false
+	}
+
+	l.requests.Add(1)
+	return true
+}
+
+// ListDatasets lists the datasets of the tenant the client can read from or append to.
+func (l *Lead) ListDatasets(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := l.requestTenant(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := l.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	names, err := l.datasetNames(r.Context(), tenant)
+	if err != nil {
+		l.log.Error("failed to list datasets", "error", err)
+		http.Error(w, "failed to list datasets", http.StatusInternalServerError)
+		return
+	}
+
+	names = slices.DeleteFunc(names, func(name string) bool {
+		return !l.canSee(id, qualifiedName(tenant, name))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+func (l *Lead) CreateDataset(w http.ResponseWriter, r *http.Request) {
+	log := l.log.With("method", r.Method, "path", r.URL.Path)
+
+	tenant, ok := l.requestTenant(w, r)
+	if !ok {
+		return
+	}
+
+	plain := r.PathValue("dataset")
+	name := qualifiedName(tenant, plain)
+
+	_, ok = l.authorize(w, r, name, auth.Admin)
+	if !ok {
+		return
+	}
+
+	if l.cfg.ReadOnly {
+		log.Error("create on read-only lead")
+		http.Error(w, "lead is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !datasetNameRegexp.MatchString(plain) {
+		log.Error("invalid dataset name", "dataset", name)
+		http.Error(w, "invalid dataset name", http.StatusBadRequest)
+		return
+	}
+
+	_, isTenant := l.cfg.Tenants[plain]
+	if tenant == "" && isTenant {
+		http.Error(w, "dataset name is taken by a tenant", http.StatusConflict)
+		return
+	}
+
+	var config dataset.DatasetConfig
+	err := json.NewDecoder(r.Body).Decode(&config)
+	if err != nil {
+		log.Error("failed to decode dataset config", "error", err)
+		http.Error(w, "invalid dataset config", http.StatusBadRequest)
+		return
+	}
+
+	if !l.startRequest() {
+		http.Error(w, "lead is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer l.requests.Done()
+
+	// the name is reserved while the dataset is created without holding l.mu, which requests to
+	// the other datasets need
+	l.mu.Lock()
+
+	_, exists := l.datasets[name]
+	if exists || l.pending[name] || l.creating[name] {
+		l.mu.Unlock()
+		http.Error(w, "dataset already exists", http.StatusConflict)
+		return
+	}
+
+	quota := l.cfg.Tenants[tenant].Datasets
+	if quota > 0 && l.tenantDatasets(tenant) >= quota {
+		l.mu.Unlock()
+		http.Error(w, "datasets quota of the tenant exceeded", http.StatusInsufficientStorage)
+		return
+	}
+
+	l.creating[name] = true
+	l.mu.Unlock()
+
+	ds, err := dataset.Create(r.Context(), dataset.CreateOptions{
+		Log:                 l.log.With("dataset", name),
+		Store:               l.store,
+		Config:              config,
+		Name:                name,
+		LocalDir:            l.localDir(name),
+		BlobmapCache:        l.cache,
+		Tiers:               l.tiers,
+		MaintenanceInterval: l.cfg.MaintenanceInterval,
+	})
+
+	l.mu.Lock()
+	delete(l.creating, name)
+	if err == nil {
+		l.datasets[name] = ds
+	}
+	l.mu.Unlock()
+
+	if errors.Is(err, dataset.ErrAlreadyExists) {
+		http.Error(w, "dataset already exists", http.StatusConflict)
+		return
+	}
+
+	if errors.Is(err, dataset.ErrInvalidConfig) {
+		log.Error("failed to create dataset", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error("failed to create dataset", "error", err)
+		http.Error(w, "failed to create dataset", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", datasetPath(tenant, plain))
+	w.WriteHeader(http.StatusCreated)
+}
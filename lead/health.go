@@ -0,0 +1,183 @@
+package lead
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/objectstore"
+)
+
+// storePingTimeout bounds checking the reachability of the store in readiness checks.
+const storePingTimeout = 5 * time.Second
+
+type checkResult struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// check runs the readiness checks: the lead is not shutting down, all datasets in the store are open, the store is reachable,
+// and every dataset has a writable head and an archiver within the lag budget.
+func (l *Lead) check(ctx context.Context) []checkResult {
+	results := []checkResult{}
+
+	add := func(name string, err error) {
+		r := checkResult{Name: name}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+
+	l.mu.RLock()
+	shuttingDown := l.shuttingDown
+	l.mu.RUnlock()
+
+	if shuttingDown {
+		add("shutdown", errors.New("lead is shutting down"))
+	}
+
+	add("datasets", l.checkOpen())
+
+	pingCtx, cancel := context.WithTimeout(ctx, storePingTimeout)
+	defer cancel()
+	add("store", objectstore.Ping(pingCtx, l.store))
+
+	lagBudget := l.cfg.ArchiveLagBudget
+	if lagBudget == 0 {
+		lagBudget = DefaultArchiveLagBudget
+	}
+
+	for _, ds := range l.sortedDatasets() {
+		add("dataset/"+ds.Name(), ds.CheckReady(lagBudget))
+	}
+
+	return results
+}
+
+func (l *Lead) checkOpen() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.listErr != nil {
+		return l.listErr
+	}
+
+	if !l.listed {
+		return errors.New("datasets are not listed yet")
+	}
+
+	if len(l.pending) > 0 {
+		names := slices.Sorted(maps.Keys(l.pending))
+		return fmt.Errorf("%d datasets are not open yet: %s", len(names), strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+func (l *Lead) sortedDatasets() []*dataset.Dataset {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := slices.Sorted(maps.Keys(l.datasets))
+	datasets := make([]*dataset.Dataset, len(names))
+	for i, name := range names {
+		datasets[i] = l.datasets[name]
+	}
+
+	return datasets
+}
+
+func ready(results []checkResult) bool {
+	for _, r := range results {
+		if r.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Healthz reports that the lead is serving requests.
+func (l *Lead) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz responds with 503 and the failed checks if the lead is not ready to serve the datasets.
+func (l *Lead) Readyz(w http.ResponseWriter, r *http.Request) {
+	results := l.check(r.Context())
+
+	w.Header().Set("Content-Type", "text/plain")
+
+	if !ready(results) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, c := range results {
+			if c.Error != "" {
+				fmt.Fprintf(w, "%s: %s\n", c.Name, c.Error)
+			}
+		}
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+type status struct {
+	Ready      bool                    `json:"ready"`
+	ReadOnly   bool                    `json:"read_only"`
+	Checks     []checkResult           `json:"checks"`
+	Opening    []string                `json:"opening,omitempty"`
+	OpenErrors map[string]string       `json:"open_errors,omitempty"`
+	Datasets   []dataset.Status        `json:"datasets"`
+	Tenants    map[string]tenantStatus `json:"tenants,omitempty"`
+}
+
+// DebugStatus responds with the readiness checks, the state of every dataset and the usage of the tenants as JSON.
+// With authentication, it is served to admins of auth.Lead only.
+func (l *Lead) DebugStatus(w http.ResponseWriter, r *http.Request) {
+	_, ok := l.authorize(w, r, auth.Lead, auth.Admin)
+	if !ok {
+		return
+	}
+
+	results := l.check(r.Context())
+
+	s := status{
+		Ready:    ready(results),
+		ReadOnly: l.cfg.ReadOnly,
+		Checks:   results,
+		Datasets: []dataset.Status{},
+	}
+
+	l.mu.RLock()
+	s.Opening = slices.Sorted(maps.Keys(l.pending))
+	if len(l.openErrs) > 0 {
+		s.OpenErrors = map[string]string{}
+		for name, err := range l.openErrs {
+			s.OpenErrors[name] = err.Error()
+		}
+	}
+	l.mu.RUnlock()
+
+	for _, ds := range l.sortedDatasets() {
+		s.Datasets = append(s.Datasets, ds.Status())
+	}
+
+	for tenant := range l.cfg.Tenants {
+		if s.Tenants == nil {
+			s.Tenants = map[string]tenantStatus{}
+		}
+		s.Tenants[tenant] = l.tenantUsage(tenant)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,123 @@
+package lead_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	archiveDir := t.TempDir()
+	stateDir := t.TempDir()
+
+	newLead := func(t *testing.T, cfg lead.Config) (*lead.Lead, string) {
+		cfg.ArchiveDir = archiveDir
+		if cfg.StateDir == "" {
+			cfg.StateDir = t.TempDir()
+		}
+		cfg.OpenInBackground = true
+
+		ld, err := lead.New(ctx, slogt.New(t), cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { ld.Close() })
+
+		s := httptest.NewServer(ld)
+		t.Cleanup(s.Close)
+
+		return ld, s.URL
+	}
+
+	ready := func(url string) func() bool {
+		return func() bool {
+			res, err := resty.New().R().Get(url + "/readyz")
+			require.NoError(t, err)
+			return res.StatusCode() == http.StatusOK
+		}
+	}
+
+	first, url := newLead(t, lead.Config{StateDir: stateDir})
+	require.Eventually(t, ready(url), 5*time.Second, 10*time.Millisecond)
+
+	res, err := resty.New().R().SetBody(dataset.DatasetConfig{
+		MaxArchiveTime: time.Hour,
+	}).Put(url + "/api/datasets/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode())
+
+	res, err = resty.New().R().SetBody([]byte("entry")).Put(url + "/api/datasets/events/0")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+	require.NoError(t, first.Close())
+
+	t.Run("opens datasets in the background", func(t *testing.T) {
+		_, url := newLead(t, lead.Config{StateDir: stateDir})
+
+		res, err := resty.New().R().Get(url + "/healthz")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		require.Eventually(t, ready(url), 5*time.Second, 10*time.Millisecond)
+
+		res, err = resty.New().R().Get(url + "/api/datasets/events/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		var status struct {
+			Ready    bool             `json:"ready"`
+			Datasets []dataset.Status `json:"datasets"`
+		}
+		res, err = resty.New().R().SetResult(&status).Get(url + "/debug/status")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.True(t, status.Ready)
+		require.Len(t, status.Datasets, 1)
+		require.Equal(t, "events", status.Datasets[0].Name)
+		require.Equal(t, uint64(0), *status.Datasets[0].LastIndex)
+		require.Equal(t, uint64(1), status.Datasets[0].UnarchivedEntries)
+	})
+
+	t.Run("archiver over the lag budget", func(t *testing.T) {
+		_, url := newLead(t, lead.Config{ArchiveLagBudget: time.Nanosecond})
+		require.Eventually(t, ready(url), 5*time.Second, 10*time.Millisecond)
+
+		res, err := resty.New().R().SetBody(dataset.DatasetConfig{
+			MaxArchiveTime: time.Millisecond,
+		}).Put(url + "/api/datasets/lagging")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, res.StatusCode())
+
+		res, err = resty.New().R().SetBody([]byte("entry")).Put(url + "/api/datasets/lagging/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+		require.Eventually(t, func() bool { return !ready(url)() }, 5*time.Second, 10*time.Millisecond)
+
+		res, err = resty.New().R().Get(url + "/readyz")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+		require.Contains(t, res.String(), "dataset/lagging: archiver is")
+	})
+
+	t.Run("store not reachable", func(t *testing.T) {
+		_, url := newLead(t, lead.Config{})
+		require.Eventually(t, ready(url), 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, os.RemoveAll(archiveDir))
+
+		res, err := resty.New().R().Get(url + "/readyz")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+		require.Contains(t, res.String(), "store: failed to stat root dir")
+	})
+}
@@ -2,45 +2,127 @@ package lead
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/blobmapcache"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/objectstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
 )
 
 type S3 struct {
-	Endpoint        string
+	// Endpoint of an S3 compatible service, empty for AWS.
+	Endpoint string
+	// AccessKeyID and SecretAccessKey are static credentials, the AWS default credential chain is used when empty.
 	AccessKeyID     string
 	SecretAccessKey string
 	Region          string
 	Bucket          string
+	// VirtualHostStyle addresses the bucket as a subdomain of the endpoint instead of a path.
+	VirtualHostStyle bool
+	// DisableHTTPS uses plain HTTP for endpoints given without a scheme.
+	DisableHTTPS bool
+	// StorageClass of uploaded objects, the bucket default when empty.
+	StorageClass string
 }
 
 type Config struct {
-	S3       S3
-	StateDir string
+	S3 S3
+	// ArchiveDir stores archives and dataset manifests in a local directory tree instead of S3 when set.
+	ArchiveDir string
+	StateDir   string
+	// ReadOnly serves the archived entries of the datasets in the store without owning their heads.
+	// Any number of read-only leads can serve the datasets of a single writing lead.
+	ReadOnly bool
+	// RefreshInterval of read-only datasets, defaults to dataset.DefaultRefreshInterval.
+	RefreshInterval time.Duration
+	// CacheSize limits the blobmap cache in StateDir, defaults to DefaultCacheSize.
+	CacheSize uint64
+	// OpenInBackground returns from New before the datasets in the store are open. Requests to
+	// datasets still opening fail with 503 and /readyz reports the lead as not ready until all are open.
+	// Datasets that fail to open are retried.
+	OpenInBackground bool
+	// ArchiveLagBudget is how long archiving a dataset can be overdue before /readyz reports
+	// the lead as not ready, defaults to DefaultArchiveLagBudget.
+	ArchiveLagBudget time.Duration
+	// ArchiveHeadOnShutdown archives the heads of the datasets in Shutdown.
+	ArchiveHeadOnShutdown bool
+	// Authenticator authenticates requests to the dataset API, /debug/status and /metrics, which
+	// Policy then authorizes. Without it, the API is open to everyone.
+	Authenticator auth.Authenticator
+	Policy        auth.Policy
+	// Tenants and their quotas. Datasets of a tenant are served under /api/tenants/{tenant}/datasets,
+	// stored under <tenant>/<dataset> in the store and StateDir, and authorized by that name.
+	// The datasets under /api/datasets belong to the default tenant, which has no quota.
+	Tenants map[string]Quota
+	// AppendLimits rate limit appends and reject them once the heads grow past their high-water marks.
+	AppendLimits AppendLimits
+	// Tiers are the stores named by the tiering rules of datasets. Read-only leads need them to
+	// read the blobs moved there.
+	Tiers map[string]Tier
+	// MaintenanceInterval is the period of compacting the archives of datasets and applying their
+	// tiering rules, defaults to dataset.DefaultMaintenanceInterval.
+	MaintenanceInterval time.Duration
 }
 
-type Lead struct {
-	http.Handler
-	s3Client *s3.Client
-}
+const (
+	DefaultCacheSize        = 1024 * 1024 * 1024
+	DefaultArchiveLagBudget = 5 * time.Minute
+)
 
-type datasetInfo struct {
-	Config       DatasetConfig `json:"config"`
-	FirstIndex   uint64        `json:"first_index"`
-	LastIndex    uint64        `json:"last_index"`
-	StorageBytes uint64        `json:"bytes"`
-}
+var datasetNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+var tracer = otel.Tracer("github.com/draganm/linear/lead")
 
-type DatasetConfig struct {
-	Name           string `json:"name"`
-	MaxArchiveSize uint64 `json:"max_archive_size"`
-	MaxArchiveTime uint64 `json:"max_archive_time"`
+type Lead struct {
+	http.Handler
+	log      *slog.Logger
+	cfg      Config
+	store    objectstore.Store
+	tiers    map[string]objectstore.Store
+	cache    *blobmapcache.BlobmapCache
+	mu       sync.RWMutex
+	datasets map[string]*dataset.Dataset
+	// listed is set once the datasets in the store are listed, pending are the listed datasets not open yet
+	listed      bool
+	listErr     error
+	pending     map[string]bool
+	openErrs    map[string]error
+	stopOpening context.CancelFunc
+	openingDone chan struct{}
+	// shuttingDown rejects new dataset requests, requests tracks the ones in progress
+	shuttingDown bool
+	requests     sync.WaitGroup
+	registry     *prometheus.Registry
+	// datasetLimiters and clientLimiters are nil without rate limits
+	datasetLimiters  *limiters
+	clientLimiters   *limiters
+	appendRejections *prometheus.CounterVec
+	// usage of the tenants checked by appends against their quotas
+	usageMu sync.Mutex
+	usage   map[string]cachedUsage
+	// opening are the opens of datasets created after a read-only lead started, missing the
+	// datasets such opens found missing and when
+	opening map[string]func() (*dataset.Dataset, error)
+	missing map[string]time.Time
+	// creating are the names of the datasets CreateDataset is creating
+	creating map[string]bool
 }
 
 func New(
@@ -48,31 +130,261 @@ func New(
 	log *slog.Logger,
 	cfg Config,
 ) (*Lead, error) {
+	err := cfg.validateTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.validateTiers()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewStore(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	storeMetrics := objectstore.NewMetrics()
+	storeName := "s3"
+	if cfg.ArchiveDir != "" {
+		storeName = "filesystem"
+	}
+	store = objectstore.Instrument(store, storeMetrics, storeName)
+
+	tiers, err := newTiers(ctx, cfg, storeMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize := cfg.CacheSize
+	if cacheSize == 0 {
+		cacheSize = DefaultCacheSize
+	}
+
+	cache, err := blobmapcache.Open(filepath.Join(cfg.StateDir, "cache"), cacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blobmap cache: %w", err)
+	}
+
 	r := http.NewServeMux()
 
-	awsConfig, err := config.LoadDefaultConfig(
-		ctx,
-		config.WithRegion(cfg.S3.Region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey, "")),
+	l := &Lead{
+		Handler: otelhttp.NewHandler(
+			r,
+			"linear",
+			otelhttp.WithSpanNameFormatter(spanName),
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				return !untracedPaths[r.URL.Path]
+			}),
+		),
+		log:      log,
+		cfg:      cfg,
+		store:    store,
+		tiers:    tiers,
+		cache:    cache,
+		datasets: map[string]*dataset.Dataset{},
+		pending:  map[string]bool{},
+		openErrs: map[string]error{},
+		opening:  map[string]func() (*dataset.Dataset, error){},
+		missing:  map[string]time.Time{},
+		creating: map[string]bool{},
+		usage:    map[string]cachedUsage{},
+		registry: prometheus.NewRegistry(),
+
+		datasetLimiters: newLimiters(cfg.AppendLimits.PerDataset),
+		clientLimiters:  newLimiters(cfg.AppendLimits.PerClient),
+		appendRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "linear_append_rejections_total",
+			Help: "Append requests rejected by quotas, high-water marks and rate limits.",
+		}, []string{"dataset", "reason"}),
+	}
+
+	l.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		storeMetrics,
+		cache,
+		datasetCollector{l},
+		l.appendRejections,
 	)
+
+	if cfg.OpenInBackground {
+		l.openInBackground()
+	} else {
+		err = l.openDatasets(ctx)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	for _, prefix := range []string{"/api/datasets", "/api/tenants/{tenant}/datasets"} {
+		r.HandleFunc("GET "+prefix, l.ListDatasets)
+		r.HandleFunc("PUT "+prefix+"/{dataset}", l.CreateDataset)
+		r.HandleFunc("GET "+prefix+"/{dataset}", l.forDataset(auth.Read, (*dataset.Dataset).GetInfo))
+		r.HandleFunc("GET "+prefix+"/{dataset}/{index}", l.forDataset(auth.Read, (*dataset.Dataset).Get))
+		r.HandleFunc("GET "+prefix+"/{dataset}/{index}/{count}", l.forDataset(auth.Read, (*dataset.Dataset).GetBatch))
+		r.HandleFunc("GET "+prefix+"/{dataset}/by-key/{key}", l.forDataset(auth.Read, (*dataset.Dataset).GetByKey))
+		r.HandleFunc("PUT "+prefix+"/{dataset}/{index}", l.forDataset(auth.Append, l.limitAppends((*dataset.Dataset).Append)))
+		r.HandleFunc("POST "+prefix+"/{dataset}", l.forDataset(auth.Append, l.limitAppends((*dataset.Dataset).AppendMulti)))
+	}
+	r.HandleFunc("GET /metrics", l.forLead(auth.Read, promhttp.HandlerFor(l.registry, promhttp.HandlerOpts{})))
+	r.HandleFunc("GET /healthz", l.Healthz)
+	r.HandleFunc("GET /readyz", l.Readyz)
+	r.HandleFunc("GET /debug/status", l.DebugStatus)
+
+	return l, nil
+}
+
+// untracedPaths are scraped and probed too often to be worth tracing.
+var untracedPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// spanName names server spans after the matched route once it is known.
+func spanName(operation string, r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	return operation + " " + r.Method
+}
+
+// NewStore creates the store holding the datasets, the local ArchiveDir if set and the S3 bucket otherwise.
+func NewStore(ctx context.Context, cfg Config) (objectstore.Store, error) {
+	if cfg.ArchiveDir != "" {
+		return objectstore.NewFilesystem(cfg.ArchiveDir)
+	}
+
+	s3Client, err := newS3Client(ctx, cfg.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	return objectstore.NewS3(s3Client, cfg.S3.Bucket, objectstore.S3Options{
+		StorageClass: cfg.S3.StorageClass,
+	}), nil
+}
+
+func newS3Client(ctx context.Context, cfg S3) (*s3.Client, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(cfg.Region),
+	}
+
+	if cfg.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	s3Client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(cfg.S3.Endpoint)
-		o.UsePathStyle = true
-		o.EndpointOptions.DisableHTTPS = true
-	})
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = !cfg.VirtualHostStyle
+		o.EndpointOptions.DisableHTTPS = cfg.DisableHTTPS
+	}), nil
+}
 
-	l := &Lead{
-		Handler:  r,
-		s3Client: s3Client,
+// Shutdown rejects new dataset requests with 503 and waits for the ones in progress, then shuts
+// down the datasets, archiving their heads if ArchiveHeadOnShutdown is set, and closes the blobmap cache.
+// Once ctx is done, requests are no longer waited for and running archive uploads are canceled,
+// datasets still wait for the reads of their heads before closing them.
+func (l *Lead) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.shuttingDown = true
+	l.mu.Unlock()
+
+	if l.stopOpening != nil {
+		l.stopOpening()
+		<-l.openingDone
 	}
 
-	r.HandleFunc("PUT /api/append/{dataset}", l.Create)
-	r.HandleFunc("POST /api/append/{dataset}", l.AppendSingle)
-	r.HandleFunc("GET /api/append/{dataset}", l.AppendSingle)
+	drained := make(chan struct{})
+	go func() {
+		l.requests.Wait()
+		close(drained)
+	}()
 
-	return l, nil
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		l.log.Warn("dataset requests did not finish before the shutdown deadline")
+	}
+
+	l.mu.Lock()
+	datasets := l.datasets
+	l.datasets = map[string]*dataset.Dataset{}
+	l.mu.Unlock()
+
+	mu := sync.Mutex{}
+	errs := []error{}
+	wg := sync.WaitGroup{}
+
+	for name, ds := range datasets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ds.Shutdown(ctx, dataset.ShutdownOptions{ArchiveHead: l.cfg.ArchiveHeadOnShutdown})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to shut down dataset %s: %w", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	l.cache.Close()
+
+	return errors.Join(errs...)
+}
+
+// Close stops opening datasets and closes all datasets and the blobmap cache.
+func (l *Lead) Close() error {
+	if l.stopOpening != nil {
+		l.stopOpening()
+		<-l.openingDone
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	errs := []error{}
+	for name, ds := range l.datasets {
+		err := ds.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close dataset %s: %w", name, err))
+		}
+	}
+	l.datasets = map[string]*dataset.Dataset{}
+
+	l.cache.Close()
+
+	return errors.Join(errs...)
+}
+
+// datasetCollector collects the metrics of the open datasets. It is unchecked, as datasets
+// come and go after it is registered.
+type datasetCollector struct {
+	l *Lead
+}
+
+func (c datasetCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c datasetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.l.mu.RLock()
+	defer c.l.mu.RUnlock()
+
+	for _, ds := range c.l.datasets {
+		ds.Collect(ch)
+	}
 }
@@ -0,0 +1,204 @@
+package lead
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/dataset"
+	"golang.org/x/time/rate"
+)
+
+// AppendLimits protect the lead from producers appending faster than the datasets are archived.
+type AppendLimits struct {
+	// PerDataset and PerClient limit the append requests, an AppendMulti request counts as one.
+	// Clients are told apart by their authenticated subject, or by their address without authentication.
+	PerDataset RateLimit
+	PerClient  RateLimit
+	// MaxHeadBytes and MaxUnarchivedEntries are high-water marks of the head of a dataset. Past them,
+	// appends are rejected with 503 until the archiver catches up. Zero disables a mark.
+	MaxHeadBytes         uint64
+	MaxUnarchivedEntries uint64
+}
+
+// RateLimit is a token bucket refilled with Rate tokens per second, zero is unlimited.
+// Burst defaults to Rate rounded up.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+const (
+	// limitersSweepSize is the number of limiters kept before idle ones are removed.
+	limitersSweepSize = 1024
+	// highWaterRetryAfter is suggested to clients of datasets over the high-water mark, roughly
+	// the time to archive a head.
+	highWaterRetryAfter = 10 * time.Second
+)
+
+// limiters are the rate limiters of clients or datasets, created on first use.
+type limiters struct {
+	limit   rate.Limit
+	burst   int
+	mu      sync.Mutex
+	byKey   map[string]*rate.Limiter
+	sweepAt int
+}
+
+func newLimiters(rl RateLimit) *limiters {
+	if rl.Rate <= 0 {
+		return nil
+	}
+
+	burst := rl.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(rl.Rate))
+	}
+
+	return &limiters{
+		limit:   rate.Limit(rl.Rate),
+		burst:   burst,
+		byKey:   map[string]*rate.Limiter{},
+		sweepAt: limitersSweepSize,
+	}
+}
+
+// reserve takes a token from the bucket of the key, nil limiters don't limit anything.
+func (ls *limiters) reserve(key string, now time.Time) *rate.Reservation {
+	if ls == nil {
+		return nil
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	lim, ok := ls.byKey[key]
+	if !ok {
+		if len(ls.byKey) >= ls.sweepAt {
+			ls.sweep(now)
+		}
+		lim = rate.NewLimiter(ls.limit, ls.burst)
+		ls.byKey[key] = lim
+	}
+
+	return lim.ReserveN(now, 1)
+}
+
+// sweep removes the limiters with full buckets, which are the same as new ones. ls.mu must be held.
+func (ls *limiters) sweep(now time.Time) {
+	for key, lim := range ls.byKey {
+		if lim.TokensAt(now) >= float64(ls.burst) {
+			delete(ls.byKey, key)
+		}
+	}
+	ls.sweepAt = max(limitersSweepSize, 2*len(ls.byKey))
+}
+
+// clientKey tells clients apart for rate limiting.
+func clientKey(r *http.Request) string {
+	id, ok := auth.FromContext(r.Context())
+	if ok {
+		return "subject:" + id.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "addr:" + r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// limitAppends rejects appends to datasets of tenants over their quota, to datasets past a high-water
+// mark and appends exceeding the rate limits.
+func (l *Lead) limitAppends(handler func(*dataset.Dataset, http.ResponseWriter, *http.Request)) func(*dataset.Dataset, http.ResponseWriter, *http.Request) {
+	return func(ds *dataset.Dataset, w http.ResponseWriter, r *http.Request) {
+		if !l.checkAppendQuota(w, ds.Name()) {
+			return
+		}
+
+		if !l.checkHighWater(w, ds) {
+			return
+		}
+
+		if !l.checkRate(w, r, ds.Name()) {
+			return
+		}
+
+		handler(ds, w, r)
+	}
+}
+
+func (l *Lead) checkHighWater(w http.ResponseWriter, ds *dataset.Dataset) bool {
+	limits := l.cfg.AppendLimits
+	if limits.MaxHeadBytes == 0 && limits.MaxUnarchivedEntries == 0 {
+		return true
+	}
+
+	backlog := ds.Backlog()
+
+	reason := ""
+	switch {
+	case limits.MaxHeadBytes > 0 && backlog.Bytes >= limits.MaxHeadBytes:
+		reason = "high_water_head_bytes"
+	case limits.MaxUnarchivedEntries > 0 && backlog.Entries >= limits.MaxUnarchivedEntries:
+		reason = "high_water_unarchived_entries"
+	default:
+		return true
+	}
+
+	l.appendRejections.WithLabelValues(ds.Name(), reason).Inc()
+	w.Header().Set("Retry-After", retryAfter(highWaterRetryAfter))
+	http.Error(w, "dataset is waiting for the archiver to catch up", http.StatusServiceUnavailable)
+	return false
+}
+
+// checkRate takes a token from the buckets of the dataset and the client, responding with 429
+// and returning the tokens if either bucket is empty.
+func (l *Lead) checkRate(w http.ResponseWriter, r *http.Request, name string) bool {
+	now := time.Now()
+
+	reservations := []struct {
+		reason string
+		r      *rate.Reservation
+	}{
+		{"rate_dataset", l.datasetLimiters.reserve(name, now)},
+		{"rate_client", l.clientLimiters.reserve(clientKey(r), now)},
+	}
+
+	reason := ""
+	delay := time.Duration(0)
+
+	for _, res := range reservations {
+		if res.r == nil {
+			continue
+		}
+		d := res.r.DelayFrom(now)
+		if d > delay {
+			reason, delay = res.reason, d
+		}
+	}
+
+	if delay == 0 {
+		return true
+	}
+
+	for _, res := range reservations {
+		if res.r != nil {
+			res.r.CancelAt(now)
+		}
+	}
+
+	l.appendRejections.WithLabelValues(name, reason).Inc()
+	w.Header().Set("Retry-After", retryAfter(delay))
+	http.Error(w, "append rate limit exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// retryAfter formats d in whole seconds, rounded up.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
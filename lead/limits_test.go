@@ -0,0 +1,101 @@
+package lead_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/auth"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendLimits(t *testing.T) {
+	ctx := context.Background()
+
+	newLead := func(t *testing.T, cfg lead.Config, datasets ...string) string {
+		cfg.ArchiveDir = t.TempDir()
+		cfg.StateDir = t.TempDir()
+
+		ld, err := lead.New(ctx, slogt.New(t), cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { ld.Close() })
+
+		s := httptest.NewServer(ld)
+		t.Cleanup(s.Close)
+
+		for _, name := range datasets {
+			res, err := resty.New().R().SetAuthToken("admin").SetBody(dataset.DatasetConfig{
+				MaxArchiveTime: time.Hour,
+			}).Put(s.URL + "/api/datasets/" + name)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusCreated, res.StatusCode())
+		}
+
+		return s.URL
+	}
+
+	appendAs := func(t *testing.T, token, url string, index int) *resty.Response {
+		res, err := resty.New().R().SetAuthToken(token).SetBody([]byte("entry")).Put(fmt.Sprintf("%s/%d", url, index))
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("per dataset rate", func(t *testing.T) {
+		url := newLead(t, lead.Config{AppendLimits: lead.AppendLimits{
+			PerDataset: lead.RateLimit{Rate: 0.01, Burst: 2},
+		}}, "events", "logs")
+
+		require.Equal(t, http.StatusNoContent, appendAs(t, "", url+"/api/datasets/events", 0).StatusCode())
+		require.Equal(t, http.StatusNoContent, appendAs(t, "", url+"/api/datasets/events", 1).StatusCode())
+
+		res := appendAs(t, "", url+"/api/datasets/events", 2)
+		require.Equal(t, http.StatusTooManyRequests, res.StatusCode())
+		require.Equal(t, "100", res.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusNoContent, appendAs(t, "", url+"/api/datasets/logs", 0).StatusCode())
+
+		res, err := resty.New().R().Get(url + "/metrics")
+		require.NoError(t, err)
+		require.Contains(t, res.String(), `linear_append_rejections_total{dataset="events",reason="rate_dataset"} 1`)
+	})
+
+	t.Run("per client rate", func(t *testing.T) {
+		url := newLead(t, lead.Config{
+			Authenticator: auth.StaticTokens(map[string]string{"admin": "admin", "a": "client-a", "b": "client-b"}),
+			Policy: auth.Policy{Grants: []auth.Grant{
+				{Subject: "*", Datasets: []string{auth.AllDatasets}, Permissions: []auth.Permission{auth.Admin}},
+			}},
+			AppendLimits: lead.AppendLimits{
+				PerClient: lead.RateLimit{Rate: 0.01, Burst: 1},
+			},
+		}, "events")
+
+		require.Equal(t, http.StatusNoContent, appendAs(t, "a", url+"/api/datasets/events", 0).StatusCode())
+		require.Equal(t, http.StatusTooManyRequests, appendAs(t, "a", url+"/api/datasets/events", 1).StatusCode())
+		require.Equal(t, http.StatusNoContent, appendAs(t, "b", url+"/api/datasets/events", 1).StatusCode())
+	})
+
+	t.Run("high-water mark", func(t *testing.T) {
+		url := newLead(t, lead.Config{AppendLimits: lead.AppendLimits{
+			MaxUnarchivedEntries: 2,
+		}}, "events")
+
+		require.Equal(t, http.StatusNoContent, appendAs(t, "", url+"/api/datasets/events", 0).StatusCode())
+		require.Equal(t, http.StatusNoContent, appendAs(t, "", url+"/api/datasets/events", 1).StatusCode())
+
+		res := appendAs(t, "", url+"/api/datasets/events", 2)
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+		require.NotEmpty(t, res.Header().Get("Retry-After"))
+
+		res, err := resty.New().R().Get(url + "/api/datasets/events/1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+	})
+}
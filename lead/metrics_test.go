@@ -0,0 +1,93 @@
+package lead_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+		ArchiveDir: t.TempDir(),
+		StateDir:   t.TempDir(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ld.Close() })
+
+	s := httptest.NewServer(ld)
+	t.Cleanup(s.Close)
+
+	res, err := resty.New().R().SetBody(dataset.DatasetConfig{
+		MaxArchiveTime: time.Hour,
+	}).Put(s.URL + "/api/datasets/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode())
+
+	for i := 0; i < 3; i++ {
+		res, err := resty.New().R().SetBody([]byte("entry")).Put(fmt.Sprintf("%s/api/datasets/events/%d", s.URL, i))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+	}
+
+	res, err = resty.New().R().SetBody([]byte("gap")).Put(s.URL + "/api/datasets/events/10")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode())
+
+	res, err = resty.New().R().Get(s.URL + "/metrics")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+
+	body := res.String()
+	for _, line := range []string{
+		`linear_dataset_appends_total{dataset="events"} 3`,
+		`linear_dataset_append_bytes_total{dataset="events"} 15`,
+		`linear_dataset_append_errors_total{dataset="events",error="index_gaps_are_not_allowed"} 1`,
+		`linear_dataset_append_duration_seconds_count{dataset="events"} 4`,
+		`linear_dataset_first_index{dataset="events"} 0`,
+		`linear_dataset_last_index{dataset="events"} 2`,
+		`linear_dataset_unarchived_entries{dataset="events"} 3`,
+		`linear_objectstore_requests_total{operation="put_if_absent",result="ok",store="filesystem"} 1`,
+		`linear_blobmap_cache_max_bytes 1.073741824e+09`,
+	} {
+		require.Contains(t, body, line)
+	}
+
+	require.Contains(t, body, `linear_dataset_oldest_unarchived_age_seconds{dataset="events"}`)
+	require.Contains(t, body, `linear_dataset_head_bytes{dataset="events"}`)
+
+	t.Run("listing datasets lists no objects", func(t *testing.T) {
+		requests := func(operation string) string {
+			res, err := resty.New().R().Get(s.URL + "/metrics")
+			require.NoError(t, err)
+			prefix := fmt.Sprintf(`linear_objectstore_requests_total{operation=%q,result="ok",store="filesystem"} `, operation)
+			for _, line := range strings.Split(res.String(), "\n") {
+				if strings.HasPrefix(line, prefix) {
+					return strings.TrimPrefix(line, prefix)
+				}
+			}
+			return "0"
+		}
+
+		lists := requests("list")
+		listDirs := requests("list_dirs")
+
+		res, err := resty.New().R().Get(s.URL + "/api/datasets")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		require.Equal(t, lists, requests("list"))
+		require.NotEqual(t, listDirs, requests("list_dirs"))
+	})
+}
@@ -0,0 +1,134 @@
+package lead_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyLead(t *testing.T) {
+	ctx := context.Background()
+	archiveDir := t.TempDir()
+
+	newLead := func(readOnly bool) string {
+		ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+			ArchiveDir:      archiveDir,
+			StateDir:        t.TempDir(),
+			ReadOnly:        readOnly,
+			RefreshInterval: 10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { ld.Close() })
+
+		s := httptest.NewServer(ld)
+		t.Cleanup(s.Close)
+
+		return s.URL
+	}
+
+	writer := newLead(false)
+
+	res, err := resty.New().R().SetBody(dataset.DatasetConfig{
+		MaxArchiveSize: 100,
+		MaxArchiveTime: time.Hour,
+	}).Put(writer + "/api/datasets/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode())
+
+	res, err = resty.New().R().SetBody(dataset.DatasetConfig{}).Put(writer + "/api/datasets/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, res.StatusCode())
+
+	replica := newLead(true)
+
+	for i := 0; i < 20; i++ {
+		res, err := resty.New().R().SetBody([]byte(fmt.Sprintf("entry-%03d", i))).Put(fmt.Sprintf("%s/api/datasets/events/%d", writer, i))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+	}
+
+	var names []string
+	res, err = resty.New().R().SetResult(&names).Get(replica + "/api/datasets")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Equal(t, []string{"events"}, names)
+
+	require.Eventually(t, func() bool {
+		res, err := resty.New().R().Get(replica + "/api/datasets/events/10")
+		require.NoError(t, err)
+		return res.StatusCode() == http.StatusOK && string(res.Body()) == "entry-010"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	res, err = resty.New().R().SetBody([]byte("x")).Put(replica + "/api/datasets/events/20")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode())
+
+	res, err = resty.New().R().SetBody(dataset.DatasetConfig{}).Put(replica + "/api/datasets/other")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode())
+
+	res, err = resty.New().R().SetBody(dataset.DatasetConfig{}).Put(writer + "/api/datasets/late")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode())
+
+	res, err = resty.New().R().Get(replica + "/api/datasets/late")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+
+	res, err = resty.New().R().Get(replica + "/api/datasets/missing")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, res.StatusCode())
+
+	t.Run("concurrent requests to a late dataset", func(t *testing.T) {
+		res, err := resty.New().R().SetBody(dataset.DatasetConfig{}).Put(writer + "/api/datasets/later")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, res.StatusCode())
+
+		var wg sync.WaitGroup
+		statuses := make(chan int, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := resty.New().R().Get(replica + "/api/datasets/later")
+				if err == nil {
+					statuses <- res.StatusCode()
+				}
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		count := 0
+		for status := range statuses {
+			require.Equal(t, http.StatusOK, status)
+			count++
+		}
+		require.Equal(t, 10, count)
+	})
+
+	t.Run("missing datasets are remembered", func(t *testing.T) {
+		res, err := resty.New().R().Get(replica + "/api/datasets/absent")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode())
+
+		res, err = resty.New().R().SetBody(dataset.DatasetConfig{}).Put(writer + "/api/datasets/absent")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, res.StatusCode())
+
+		// not looked up again right away
+		res, err = resty.New().R().Get(replica + "/api/datasets/absent")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode())
+	})
+}
@@ -0,0 +1,59 @@
+package lead_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	ctx := context.Background()
+	archiveDir := t.TempDir()
+
+	ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+		ArchiveDir:            archiveDir,
+		StateDir:              t.TempDir(),
+		ArchiveHeadOnShutdown: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ld.Close() })
+
+	s := httptest.NewServer(ld)
+	t.Cleanup(s.Close)
+
+	res, err := resty.New().R().SetBody(dataset.DatasetConfig{
+		MaxArchiveTime: time.Hour,
+	}).Put(s.URL + "/api/datasets/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode())
+
+	res, err = resty.New().R().SetBody([]byte("entry")).Put(s.URL + "/api/datasets/events/0")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, ld.Shutdown(shutdownCtx))
+
+	res, err = resty.New().R().SetBody([]byte("late")).Put(s.URL + "/api/datasets/events/1")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+
+	res, err = resty.New().R().Get(s.URL + "/readyz")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+	require.Contains(t, res.String(), "shutdown: lead is shutting down")
+
+	blobs, err := filepath.Glob(filepath.Join(archiveDir, "events", "blobs", "blob-*"))
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+}
@@ -0,0 +1,195 @@
+package lead
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Quota limits the storage of a tenant, zero values are unlimited. Datasets over their byte quotas
+// reject appends, which can overshoot the quotas by the appends in progress and by those accepted
+// within tenantUsageTTL of crossing them.
+type Quota struct {
+	Datasets int `json:"datasets,omitempty"`
+	// ArchivedBytes limits the size of the archived blobs of all datasets of the tenant.
+	ArchivedBytes uint64 `json:"archived_bytes,omitempty"`
+	// HeadBytes limits the size of the heads of all datasets of the tenant.
+	HeadBytes uint64 `json:"head_bytes,omitempty"`
+}
+
+// reservedTenants are names of directories in StateDir.
+var reservedTenants = map[string]bool{
+	"cache":    true,
+	"datasets": true,
+}
+
+func (cfg Config) validateTenants() error {
+	for tenant := range cfg.Tenants {
+		if !datasetNameRegexp.MatchString(tenant) {
+			return fmt.Errorf("invalid tenant name %q", tenant)
+		}
+		if reservedTenants[tenant] {
+			return fmt.Errorf("tenant name %q is reserved", tenant)
+		}
+	}
+	return nil
+}
+
+// tenants returns the names of all tenants, including the default tenant "".
+func (l *Lead) tenants() []string {
+	tenants := []string{""}
+	for tenant := range l.cfg.Tenants {
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+// qualifiedName is the name of a dataset of the tenant in the store, in StateDir and in the lead.
+// Datasets of the default tenant keep their plain names.
+func qualifiedName(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + "/" + name
+}
+
+// datasetPath is the path of a dataset of the tenant in the API.
+func datasetPath(tenant, name string) string {
+	if tenant == "" {
+		return path.Join("/api/datasets", name)
+	}
+	return path.Join("/api/tenants", tenant, "datasets", name)
+}
+
+func splitQualifiedName(qualified string) (tenant, name string) {
+	tenant, name, ok := strings.Cut(qualified, "/")
+	if !ok {
+		return "", qualified
+	}
+	return tenant, name
+}
+
+// requestTenant returns the tenant of the request, responding with 404 if it is not configured.
+func (l *Lead) requestTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenant := r.PathValue("tenant")
+	if tenant == "" {
+		return "", true
+	}
+
+	_, ok := l.cfg.Tenants[tenant]
+	if !ok {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return "", false
+	}
+
+	return tenant, true
+}
+
+// tenantStatus is the usage and the quota of a tenant.
+type tenantStatus struct {
+	Datasets      int    `json:"datasets"`
+	ArchivedBytes uint64 `json:"archived_bytes"`
+	HeadBytes     uint64 `json:"head_bytes"`
+	Quota         Quota  `json:"quota"`
+}
+
+// tenantUsage returns the usage of the open datasets of the tenant, datasets still opening are
+// counted but their bytes are not. The datasets keep their totals, so it doesn't look at blobs.
+func (l *Lead) tenantUsage(tenant string) tenantStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	s := tenantStatus{
+		Datasets: l.tenantDatasets(tenant),
+		Quota:    l.cfg.Tenants[tenant],
+	}
+
+	for qualified, ds := range l.datasets {
+		t, _ := splitQualifiedName(qualified)
+		if t == tenant {
+			u := ds.Usage()
+			s.ArchivedBytes += u.ArchivedBytes
+			s.HeadBytes += u.HeadBytes
+		}
+	}
+
+	return s
+}
+
+// tenantUsageTTL is how long appends check the quotas against the same usage of a tenant, which
+// spares them locking every dataset of the tenant.
+const tenantUsageTTL = 100 * time.Millisecond
+
+type cachedUsage struct {
+	usage tenantStatus
+	at    time.Time
+}
+
+// cachedTenantUsage returns the usage of the tenant, at most tenantUsageTTL old.
+func (l *Lead) cachedTenantUsage(tenant string) tenantStatus {
+	l.usageMu.Lock()
+	defer l.usageMu.Unlock()
+
+	c, ok := l.usage[tenant]
+	if ok && time.Since(c.at) < tenantUsageTTL {
+		return c.usage
+	}
+
+	c = cachedUsage{usage: l.tenantUsage(tenant), at: time.Now()}
+	l.usage[tenant] = c
+	return c.usage
+}
+
+// tenantDatasets counts the open, pending and creating datasets of the tenant, l.mu must be held.
+func (l *Lead) tenantDatasets(tenant string) int {
+	count := 0
+	for qualified := range l.datasets {
+		t, _ := splitQualifiedName(qualified)
+		if t == tenant {
+			count++
+		}
+	}
+	for qualified := range l.pending {
+		t, _ := splitQualifiedName(qualified)
+		if t == tenant {
+			count++
+		}
+	}
+	for qualified := range l.creating {
+		t, _ := splitQualifiedName(qualified)
+		if t == tenant {
+			count++
+		}
+	}
+	return count
+}
+
+// checkAppendQuota responds with 429 if the heads of the tenant are over their quota, which
+// archiving frees up, or with 507 if the archived blobs are over their quota.
+func (l *Lead) checkAppendQuota(w http.ResponseWriter, qualified string) bool {
+	tenant, _ := splitQualifiedName(qualified)
+
+	quota := l.cfg.Tenants[tenant]
+	if quota.ArchivedBytes == 0 && quota.HeadBytes == 0 {
+		return true
+	}
+
+	usage := l.cachedTenantUsage(tenant)
+
+	if quota.ArchivedBytes > 0 && usage.ArchivedBytes >= quota.ArchivedBytes {
+		l.appendRejections.WithLabelValues(qualified, "quota_archived_bytes").Inc()
+		http.Error(w, "archived bytes quota of the tenant exceeded", http.StatusInsufficientStorage)
+		return false
+	}
+
+	if quota.HeadBytes > 0 && usage.HeadBytes >= quota.HeadBytes {
+		l.appendRejections.WithLabelValues(qualified, "quota_head_bytes").Inc()
+		w.Header().Set("Retry-After", retryAfter(highWaterRetryAfter))
+		http.Error(w, "head bytes quota of the tenant exceeded", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,173 @@
+package lead_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	archiveDir := t.TempDir()
+	stateDir := t.TempDir()
+
+	tenants := map[string]lead.Quota{
+		"acme":     {Datasets: 1, HeadBytes: 20},
+		"globex":   {},
+		"initech":  {ArchivedBytes: 1},
+		"umbrella": {Datasets: 2},
+	}
+
+	newLead := func(t *testing.T, tenants map[string]lead.Quota) (*lead.Lead, string, error) {
+		ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+			ArchiveDir: archiveDir,
+			StateDir:   stateDir,
+			Tenants:    tenants,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		s := httptest.NewServer(ld)
+		t.Cleanup(s.Close)
+
+		return ld, s.URL, nil
+	}
+
+	ld, url, err := newLead(t, tenants)
+	require.NoError(t, err)
+
+	put := func(path string, body any) *resty.Response {
+		res, err := resty.New().R().SetBody(body).Put(url + path)
+		require.NoError(t, err)
+		return res
+	}
+
+	get := func(path string) *resty.Response {
+		res, err := resty.New().R().Get(url + path)
+		require.NoError(t, err)
+		return res
+	}
+
+	config := dataset.DatasetConfig{MaxArchiveTime: time.Hour}
+
+	for _, path := range []string{"/api/datasets/events", "/api/tenants/acme/datasets/events", "/api/tenants/globex/datasets/events"} {
+		res := put(path, config)
+		require.Equal(t, http.StatusCreated, res.StatusCode(), path)
+		require.Equal(t, path, res.Header().Get("Location"))
+		require.Equal(t, http.StatusNoContent, put(path+"/0", []byte(path)).StatusCode(), path)
+	}
+
+	for _, path := range []string{"/api/datasets/events", "/api/tenants/acme/datasets/events", "/api/tenants/globex/datasets/events"} {
+		res := get(path + "/0")
+		require.Equal(t, http.StatusOK, res.StatusCode(), path)
+		require.Equal(t, path, res.String())
+	}
+
+	require.FileExists(t, filepath.Join(archiveDir, "acme", "events", "dataset.json"))
+	require.DirExists(t, filepath.Join(stateDir, "acme", "events"))
+	require.DirExists(t, filepath.Join(stateDir, "datasets", "events"))
+
+	names := []string{}
+	_, err = resty.New().R().SetResult(&names).Get(url + "/api/tenants/globex/datasets")
+	require.NoError(t, err)
+	require.Equal(t, []string{"events"}, names)
+
+	_, err = resty.New().R().SetResult(&names).Get(url + "/api/datasets")
+	require.NoError(t, err)
+	require.Equal(t, []string{"events"}, names)
+
+	t.Run("unknown tenant", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, get("/api/tenants/hooli/datasets/events/0").StatusCode())
+		require.Equal(t, http.StatusNotFound, put("/api/tenants/hooli/datasets/events", config).StatusCode())
+	})
+
+	t.Run("dataset with the name of a tenant", func(t *testing.T) {
+		require.Equal(t, http.StatusConflict, put("/api/datasets/acme", config).StatusCode())
+	})
+
+	t.Run("datasets quota", func(t *testing.T) {
+		require.Equal(t, http.StatusInsufficientStorage, put("/api/tenants/acme/datasets/more", config).StatusCode())
+		require.Equal(t, http.StatusConflict, put("/api/tenants/acme/datasets/events", config).StatusCode())
+	})
+
+	t.Run("concurrent creates", func(t *testing.T) {
+		statuses := make(chan int, 10)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := resty.New().R().SetBody(config).Put(fmt.Sprintf("%s/api/tenants/umbrella/datasets/events-%d", url, i))
+				if err != nil {
+					statuses <- 0
+					return
+				}
+				statuses <- res.StatusCode()
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		counts := map[int]int{}
+		for status := range statuses {
+			counts[status]++
+		}
+		require.Equal(t, map[int]int{http.StatusCreated: 2, http.StatusInsufficientStorage: 8}, counts)
+	})
+
+	t.Run("head bytes quota", func(t *testing.T) {
+		// the usage appends check against is refreshed shortly
+		var res *resty.Response
+		require.Eventually(t, func() bool {
+			res = put("/api/tenants/acme/datasets/events/1", []byte("over"))
+			return res.StatusCode() == http.StatusTooManyRequests
+		}, 5*time.Second, 10*time.Millisecond)
+		require.NotEmpty(t, res.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusNoContent, put("/api/tenants/globex/datasets/events/1", []byte("unlimited")).StatusCode())
+	})
+
+	t.Run("archived bytes quota", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, put("/api/tenants/initech/datasets/events", dataset.DatasetConfig{MaxArchiveSize: 1}).StatusCode())
+		require.Equal(t, http.StatusNoContent, put("/api/tenants/initech/datasets/events/0", []byte("entry")).StatusCode())
+
+		require.Eventually(t, func() bool {
+			return put("/api/tenants/initech/datasets/events/1", []byte("entry")).StatusCode() == http.StatusInsufficientStorage
+		}, 10*time.Second, 10*time.Millisecond)
+	})
+
+	require.NoError(t, ld.Close())
+
+	t.Run("reopens the datasets of the tenants", func(t *testing.T) {
+		ld, url, err := newLead(t, tenants)
+		require.NoError(t, err)
+		t.Cleanup(func() { ld.Close() })
+
+		res, err := resty.New().R().Get(url + "/api/tenants/acme/datasets/events/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, "/api/tenants/acme/datasets/events", res.String())
+	})
+
+	t.Run("tenant with the name of a dataset", func(t *testing.T) {
+		_, _, err := newLead(t, map[string]lead.Quota{"events": {}})
+		require.ErrorContains(t, err, "has the name of a tenant")
+	})
+
+	t.Run("reserved tenant name", func(t *testing.T) {
+		_, _, err := newLead(t, map[string]lead.Quota{"cache": {}})
+		require.ErrorContains(t, err, "reserved")
+	})
+}
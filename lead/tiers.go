@@ -0,0 +1,73 @@
+package lead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/draganm/linear/objectstore"
+)
+
+// Tier is a store the tiering rules of datasets move archived blobs to, a local directory if Dir is
+// set and an S3 bucket reached with the settings of Config.S3 otherwise. Blobs keep their keys in the
+// tier, which must not be the store of the datasets.
+type Tier struct {
+	Dir    string
+	Bucket string
+	// StorageClass of the blobs moved to the bucket, the bucket default when empty.
+	StorageClass string
+}
+
+func (cfg Config) validateTiers() error {
+	for name, t := range cfg.Tiers {
+		if name == "" {
+			return errors.New("tier without a name")
+		}
+
+		if (t.Dir == "") == (t.Bucket == "") {
+			return fmt.Errorf("tier %q needs either a dir or a bucket", name)
+		}
+
+		if t.Dir != "" && cfg.ArchiveDir != "" && filepath.Clean(t.Dir) == filepath.Clean(cfg.ArchiveDir) {
+			return fmt.Errorf("tier %q is the archive dir", name)
+		}
+
+		if t.Bucket != "" && cfg.ArchiveDir == "" && t.Bucket == cfg.S3.Bucket {
+			return fmt.Errorf("tier %q is the S3 bucket of the datasets", name)
+		}
+	}
+	return nil
+}
+
+// newTiers creates the stores of the tiers, recording their requests in m with the store label tier-<name>.
+func newTiers(ctx context.Context, cfg Config, m *objectstore.Metrics) (map[string]objectstore.Store, error) {
+	if len(cfg.Tiers) == 0 {
+		return nil, nil
+	}
+
+	tiers := map[string]objectstore.Store{}
+	for name, t := range cfg.Tiers {
+		var store objectstore.Store
+
+		if t.Dir != "" {
+			fs, err := objectstore.NewFilesystem(t.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open store of tier %q: %w", name, err)
+			}
+			store = fs
+		} else {
+			s3Client, err := newS3Client(ctx, cfg.S3)
+			if err != nil {
+				return nil, err
+			}
+			store = objectstore.NewS3(s3Client, t.Bucket, objectstore.S3Options{
+				StorageClass: t.StorageClass,
+			})
+		}
+
+		tiers[name] = objectstore.Instrument(store, m, "tier-"+name)
+	}
+
+	return tiers, nil
+}
@@ -0,0 +1,97 @@
+package lead_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/archive"
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiering(t *testing.T) {
+	ctx := context.Background()
+	archiveDir := t.TempDir()
+	tierDir := t.TempDir()
+
+	newLead := func(t *testing.T, readOnly bool, tiers map[string]lead.Tier) (*lead.Lead, string, error) {
+		ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+			ArchiveDir:          archiveDir,
+			StateDir:            t.TempDir(),
+			ReadOnly:            readOnly,
+			Tiers:               tiers,
+			MaintenanceInterval: 10 * time.Millisecond,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		s := httptest.NewServer(ld)
+		t.Cleanup(s.Close)
+		t.Cleanup(func() { ld.Close() })
+
+		return ld, s.URL, nil
+	}
+
+	tiers := map[string]lead.Tier{"cold": {Dir: tierDir}}
+
+	_, url, err := newLead(t, false, tiers)
+	require.NoError(t, err)
+
+	put := func(path string, body any) *resty.Response {
+		res, err := resty.New().R().SetBody(body).Put(url + path)
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("unknown tier", func(t *testing.T) {
+		res := put("/api/datasets/lukewarm", dataset.DatasetConfig{
+			MaxArchiveSize: 1,
+			Tiering:        []archive.TieringRule{{Tier: "lukewarm"}},
+		})
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+	})
+
+	require.Equal(t, http.StatusCreated, put("/api/datasets/events", dataset.DatasetConfig{
+		MaxArchiveSize: 1,
+		Tiering:        []archive.TieringRule{{Tier: "cold"}},
+	}).StatusCode())
+	require.Equal(t, http.StatusNoContent, put("/api/datasets/events/0", []byte("entry")).StatusCode())
+
+	require.Eventually(t, func() bool {
+		moved, err := os.ReadDir(filepath.Join(tierDir, "events", "blobs"))
+		if err != nil || len(moved) == 0 {
+			return false
+		}
+		left, err := os.ReadDir(filepath.Join(archiveDir, "events", "blobs"))
+		return err == nil && len(left) == 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	res, err := resty.New().R().Get(url + "/api/datasets/events/0")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Equal(t, "entry", res.String())
+
+	t.Run("read-only lead reads the tier", func(t *testing.T) {
+		_, url, err := newLead(t, true, tiers)
+		require.NoError(t, err)
+
+		res, err := resty.New().R().Get(url + "/api/datasets/events/0")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, "entry", res.String())
+	})
+
+	t.Run("tier in the archive dir", func(t *testing.T) {
+		_, _, err := newLead(t, true, map[string]lead.Tier{"cold": {Dir: archiveDir}})
+		require.ErrorContains(t, err, "is the archive dir")
+	})
+}
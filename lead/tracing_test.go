@@ -0,0 +1,94 @@
+package lead_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/draganm/linear/dataset"
+	"github.com/draganm/linear/lead"
+	"github.com/go-resty/resty/v2"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	// the global provider can be set only once for the tracers of the packages to pick it up
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx := context.Background()
+
+	ld, err := lead.New(ctx, slogt.New(t), lead.Config{
+		ArchiveDir: t.TempDir(),
+		StateDir:   t.TempDir(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ld.Close() })
+
+	s := httptest.NewServer(ld)
+	t.Cleanup(s.Close)
+
+	res, err := resty.New().R().SetBody(dataset.DatasetConfig{
+		MaxArchiveSize: 1,
+	}).Put(s.URL + "/api/datasets/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode())
+
+	res, err = resty.New().R().SetBody([]byte("entry")).Put(s.URL + "/api/datasets/events/0")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode())
+
+	named := func(name string) []sdktrace.ReadOnlySpan {
+		return slices.DeleteFunc(recorder.Ended(), func(s sdktrace.ReadOnlySpan) bool {
+			return s.Name() != name
+		})
+	}
+
+	require.Eventually(t, func() bool {
+		return len(named("archive.Append")) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	archiveHead := named("dataset.archiveHead")[0]
+	for _, name := range []string{"archive.Append", "archive.buildBlob", "archive.uploadBlob"} {
+		require.Equal(t, archiveHead.SpanContext().TraceID(), named(name)[0].SpanContext().TraceID(), name)
+	}
+
+	traceID := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	res, err = resty.New().R().
+		SetHeader("traceparent", fmt.Sprintf("00-%s-0102030405060708-01", traceID)).
+		Get(s.URL + "/api/datasets/events/0/1")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+
+	for _, name := range []string{
+		"GET /api/datasets/{dataset}/{index}/{count}",
+		"dataset.GetBatch",
+		"archive.Read",
+		"archive.readStep",
+	} {
+		spans := slices.DeleteFunc(named(name), func(s sdktrace.ReadOnlySpan) bool {
+			return s.SpanContext().TraceID() != traceID
+		})
+		require.Len(t, spans, 1, name)
+	}
+
+	server := named("GET /api/datasets/{dataset}/{index}/{count}")[0]
+	require.Equal(t, trace.SpanKindServer, server.SpanKind())
+	require.True(t, server.Parent().IsRemote())
+
+	put := named("objectstore.put_if_absent")
+	require.Len(t, put, 1)
+	require.Equal(t, named("PUT /api/datasets/{dataset}")[0].SpanContext().TraceID(), put[0].SpanContext().TraceID())
+}
@@ -157,6 +157,24 @@ func NewCache[T any](
 	}
 }
 
+func (c *Cache[T]) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.mapByKey[key]
+	return ok
+}
+
+func (c *Cache[T]) MaxSize() uint64 {
+	return c.maxSize
+}
+
+// Size returns the total size of the cached values.
+func (c *Cache[T]) Size() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.currentSize
+}
+
 func (c *Cache[T]) Close(closeValue func(string, T) error) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
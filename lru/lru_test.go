@@ -224,3 +224,22 @@ func TestCache_MoveToFront(t *testing.T) {
 	assert.Equal(t, "3", cache.listHead.next.key)
 	assert.Equal(t, "1", cache.listHead.next.next.key)
 }
+
+func TestCache_MaxSize(t *testing.T) {
+	cache := NewCache[string](42, nil)
+	assert.Equal(t, uint64(42), cache.MaxSize())
+}
+
+func TestCache_Size(t *testing.T) {
+	cache := NewCache[string](20, nil)
+	assert.Equal(t, uint64(0), cache.Size())
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := cache.Get(key, func() (string, uint64, error) {
+			return key, 8, nil
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, uint64(16), cache.Size())
+}
@@ -0,0 +1,243 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const tempFilePrefix = ".tmp-"
+
+// Filesystem is a Store keeping objects as files in a directory tree.
+// Objects are written to a temporary file and renamed into place, readers never see partial objects.
+type Filesystem struct {
+	root string
+}
+
+func NewFilesystem(root string) (*Filesystem, error) {
+	err := os.MkdirAll(root, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root dir: %w", err)
+	}
+	return &Filesystem{root: root}, nil
+}
+
+// Ping checks that the root dir exists.
+func (f *Filesystem) Ping(ctx context.Context) error {
+	st, err := os.Stat(f.root)
+	if err != nil {
+		return fmt.Errorf("failed to stat root dir: %w", err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("root %s is not a dir", f.root)
+	}
+	return nil
+}
+
+func (f *Filesystem) filePath(key string) string {
+	return filepath.Join(f.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (f *Filesystem) LocalPath(key string) string {
+	return f.filePath(key)
+}
+
+func (f *Filesystem) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	infos := []ObjectInfo{}
+
+	walkRoot := filepath.Join(f.root, filepath.FromSlash(path.Dir(prefix)))
+
+	err := filepath.WalkDir(walkRoot, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		infos = append(infos, ObjectInfo{
+			Key:          key,
+			Size:         uint64(fi.Size()),
+			LastModified: fi.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+
+	slices.SortFunc(infos, func(a, b ObjectInfo) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return infos, nil
+}
+
+func (f *Filesystem) ListDirs(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(f.filePath(prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dirs of %s: %w", prefix, err)
+	}
+
+	dirs := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name())
+		}
+	}
+
+	return dirs, nil
+}
+
+func (f *Filesystem) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(f.filePath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	return file, nil
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+func (f *Filesystem) GetRange(ctx context.Context, key string, offset, length uint64) (io.ReadCloser, error) {
+	file, err := os.Open(f.filePath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	return sectionReadCloser{io.NewSectionReader(file, int64(offset), int64(length)), file}, nil
+}
+
+// writeTemp writes the object into a temporary file in the directory of the object.
+func (f *Filesystem) writeTemp(key string, r io.Reader) (string, error) {
+	dir := filepath.Dir(f.filePath(key))
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create dir for %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for %s: %w", key, err)
+	}
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to sync %s: %w", key, err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to close %s: %w", key, err)
+	}
+
+	return tmp.Name(), nil
+}
+
+func (f *Filesystem) Put(ctx context.Context, key string, r io.Reader) error {
+	tmp, err := f.writeTemp(key, r)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, f.filePath(key))
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to publish %s: %w", key, err)
+	}
+
+	return syncDir(filepath.Dir(f.filePath(key)))
+}
+
+// syncDir makes a rename or link in the directory durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open dir %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync dir %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+func (f *Filesystem) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	tmp, err := f.writeTemp(key, r)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	// unlike rename, link fails if the target exists
+	err = os.Link(tmp, f.filePath(key))
+	if errors.Is(err, fs.ErrExist) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish %s: %w", key, err)
+	}
+
+	return syncDir(filepath.Dir(f.filePath(key)))
+}
+
+func (f *Filesystem) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.filePath(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
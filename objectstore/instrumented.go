@@ -0,0 +1,185 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/draganm/linear/objectstore")
+
+// Metrics counts and times the requests of instrumented stores, see Instrument.
+// It is a prometheus.Collector.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "linear_objectstore_requests_total",
+			Help: "Requests to object stores by result: ok, not_found, already_exists or error.",
+		}, []string{"store", "operation", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "linear_objectstore_request_duration_seconds",
+			Help:    "Duration of requests to object stores. Get and GetRange are timed until the object starts streaming.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"store", "operation"}),
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+}
+
+// Instrument wraps a store recording its requests in m with the store label set to name,
+// and tracing each of them with a client span of the global tracer provider.
+// The wrapper implements Downloader and LocalFiles if the store does, and always Pinger.
+func Instrument(s Store, m *Metrics, name string) Store {
+	i := &instrumented{store: s, metrics: m, name: name}
+
+	switch s.(type) {
+	case LocalFiles:
+		return &instrumentedLocalFiles{i}
+	case Downloader:
+		return &instrumentedDownloader{i}
+	default:
+		return i
+	}
+}
+
+type instrumented struct {
+	store   Store
+	metrics *Metrics
+	name    string
+}
+
+// start starts a span for the operation and returns the context to run it in and a function recording its result.
+func (i *instrumented) start(
+	ctx context.Context,
+	operation string,
+	attrs ...attribute.KeyValue,
+) (context.Context, func(err error)) {
+	begin := time.Now()
+	ctx, span := tracer.Start(
+		ctx,
+		"objectstore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("linear.store", i.name)),
+		trace.WithAttributes(attrs...),
+	)
+
+	return ctx, func(err error) {
+		result := "ok"
+		switch {
+		case errors.Is(err, ErrNotFound):
+			result = "not_found"
+		case errors.Is(err, ErrAlreadyExists):
+			result = "already_exists"
+		case err != nil:
+			result = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		i.metrics.requests.WithLabelValues(i.name, operation, result).Inc()
+		i.metrics.duration.WithLabelValues(i.name, operation).Observe(time.Since(begin).Seconds())
+
+		span.SetAttributes(attribute.String("linear.result", result))
+		span.End()
+	}
+}
+
+func keyAttr(key string) attribute.KeyValue {
+	return attribute.String("linear.key", key)
+}
+
+func (i *instrumented) List(ctx context.Context, prefix string) (infos []ObjectInfo, err error) {
+	ctx, done := i.start(ctx, "list", attribute.String("linear.prefix", prefix))
+	defer func() { done(err) }()
+	return i.store.List(ctx, prefix)
+}
+
+func (i *instrumented) ListDirs(ctx context.Context, prefix string) (dirs []string, err error) {
+	ctx, done := i.start(ctx, "list_dirs", attribute.String("linear.prefix", prefix))
+	defer func() { done(err) }()
+	return i.store.ListDirs(ctx, prefix)
+}
+
+func (i *instrumented) Get(ctx context.Context, key string) (r io.ReadCloser, err error) {
+	ctx, done := i.start(ctx, "get", keyAttr(key))
+	defer func() { done(err) }()
+	return i.store.Get(ctx, key)
+}
+
+func (i *instrumented) GetRange(ctx context.Context, key string, offset, length uint64) (r io.ReadCloser, err error) {
+	ctx, done := i.start(
+		ctx,
+		"get_range",
+		keyAttr(key),
+		attribute.Int64("linear.offset", int64(offset)),
+		attribute.Int64("linear.length", int64(length)),
+	)
+	defer func() { done(err) }()
+	return i.store.GetRange(ctx, key, offset, length)
+}
+
+func (i *instrumented) Put(ctx context.Context, key string, r io.Reader) (err error) {
+	ctx, done := i.start(ctx, "put", keyAttr(key))
+	defer func() { done(err) }()
+	return i.store.Put(ctx, key, r)
+}
+
+func (i *instrumented) PutIfAbsent(ctx context.Context, key string, r io.Reader) (err error) {
+	ctx, done := i.start(ctx, "put_if_absent", keyAttr(key))
+	defer func() { done(err) }()
+	return i.store.PutIfAbsent(ctx, key, r)
+}
+
+func (i *instrumented) Delete(ctx context.Context, key string) (err error) {
+	ctx, done := i.start(ctx, "delete", keyAttr(key))
+	defer func() { done(err) }()
+	return i.store.Delete(ctx, key)
+}
+
+// Ping is recorded only if the store implements Pinger.
+func (i *instrumented) Ping(ctx context.Context) (err error) {
+	if _, ok := i.store.(Pinger); !ok {
+		return nil
+	}
+	ctx, done := i.start(ctx, "ping")
+	defer func() { done(err) }()
+	return Ping(ctx, i.store)
+}
+
+type instrumentedDownloader struct {
+	*instrumented
+}
+
+func (i *instrumentedDownloader) Download(ctx context.Context, key string, w io.WriterAt) (err error) {
+	ctx, done := i.start(ctx, "download", keyAttr(key))
+	defer func() { done(err) }()
+	return i.store.(Downloader).Download(ctx, key, w)
+}
+
+type instrumentedLocalFiles struct {
+	*instrumented
+}
+
+func (i *instrumentedLocalFiles) LocalPath(key string) string {
+	return i.store.(LocalFiles).LocalPath(key)
+}
@@ -0,0 +1,142 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data         []byte
+	lastModified time.Time
+}
+
+// Memory is a Store keeping objects in memory, meant for tests and single process setups.
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		objects: map[string]memoryObject{},
+	}
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := []ObjectInfo{}
+	for key, o := range m.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		infos = append(infos, ObjectInfo{
+			Key:          key,
+			Size:         uint64(len(o.data)),
+			LastModified: o.lastModified,
+		})
+	}
+
+	slices.SortFunc(infos, func(a, b ObjectInfo) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return infos, nil
+}
+
+func (m *Memory) ListDirs(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dirs := map[string]bool{}
+	for key := range m.objects {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		dir, _, ok := strings.Cut(rest, "/")
+		if ok {
+			dirs[dir] = true
+		}
+	}
+
+	return slices.Sorted(maps.Keys(dirs)), nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(o.data)), nil
+}
+
+func (m *Memory) GetRange(ctx context.Context, key string, offset, length uint64) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if offset+length > uint64(len(o.data)) {
+		return nil, fmt.Errorf("range %d-%d is outside of object %s of size %d", offset, offset+length, key, len(o.data))
+	}
+
+	return io.NopCloser(bytes.NewReader(o.data[offset : offset+length])), nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader) error {
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object data: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{data: d, lastModified: time.Now()}
+
+	return nil
+}
+
+func (m *Memory) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object data: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.objects[key]
+	if exists {
+		return ErrAlreadyExists
+	}
+
+	m.objects[key] = memoryObject{data: d, lastModified: time.Now()}
+
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+
+	return nil
+}
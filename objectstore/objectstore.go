@@ -0,0 +1,61 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+var ErrAlreadyExists = errors.New("object already exists")
+
+type ObjectInfo struct {
+	Key          string
+	Size         uint64
+	LastModified time.Time
+}
+
+// Store is the object storage used for archived blobs and dataset manifests.
+// Keys are slash separated paths.
+type Store interface {
+	// List returns all objects with keys starting with prefix, ordered by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// ListDirs returns the names of the directories directly below prefix, which is empty or ends
+	// with /, ordered by name. The filesystem store also returns directories left empty by deletes.
+	ListDirs(ctx context.Context, prefix string) ([]string, error)
+	// Get returns ErrNotFound if the object does not exist.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange returns length bytes of the object starting at offset.
+	GetRange(ctx context.Context, key string, offset, length uint64) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, r io.Reader) error
+	// PutIfAbsent returns ErrAlreadyExists if the object exists.
+	PutIfAbsent(ctx context.Context, key string, r io.Reader) error
+	// Delete does not fail if the object does not exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// Downloader is implemented by stores that can fetch an object faster than streaming it from Get.
+type Downloader interface {
+	Download(ctx context.Context, key string, w io.WriterAt) error
+}
+
+// LocalFiles is implemented by stores keeping each object in a local file that can be read in place.
+type LocalFiles interface {
+	LocalPath(key string) string
+}
+
+// Pinger is implemented by stores that can check that they are reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the store is reachable. Stores that do not implement Pinger always are.
+func Ping(ctx context.Context, s Store) error {
+	p, ok := s.(Pinger)
+	if !ok {
+		return nil
+	}
+	return p.Ping(ctx)
+}
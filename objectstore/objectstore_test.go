@@ -0,0 +1,158 @@
+package objectstore_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/linear/e2eutils"
+	"github.com/draganm/linear/objectstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, store objectstore.Store) {
+	ctx := context.Background()
+
+	read := func(r io.ReadCloser, err error) []byte {
+		require.NoError(t, err)
+		defer r.Close()
+		d, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return d
+	}
+
+	require.NoError(t, objectstore.Ping(ctx, store))
+
+	_, err := store.Get(ctx, "a/b")
+	require.ErrorIs(t, err, objectstore.ErrNotFound)
+
+	err = store.Put(ctx, "a/b", bytes.NewReader([]byte("hello world")))
+	require.NoError(t, err)
+
+	err = store.Put(ctx, "a/c/d", bytes.NewReader([]byte("foo")))
+	require.NoError(t, err)
+
+	err = store.Put(ctx, "b", bytes.NewReader([]byte("bar")))
+	require.NoError(t, err)
+
+	require.Equal(t, []byte("hello world"), read(store.Get(ctx, "a/b")))
+	require.Equal(t, []byte("world"), read(store.GetRange(ctx, "a/b", 6, 5)))
+
+	infos, err := store.List(ctx, "a/")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Equal(t, "a/b", infos[0].Key)
+	require.Equal(t, uint64(11), infos[0].Size)
+	require.False(t, infos[0].LastModified.IsZero())
+	require.Equal(t, "a/c/d", infos[1].Key)
+
+	infos, err = store.List(ctx, "a/c")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+
+	infos, err = store.List(ctx, "x/")
+	require.NoError(t, err)
+	require.Empty(t, infos)
+
+	dirs, err := store.ListDirs(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, dirs)
+
+	dirs, err = store.ListDirs(ctx, "a/")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, dirs)
+
+	dirs, err = store.ListDirs(ctx, "x/")
+	require.NoError(t, err)
+	require.Empty(t, dirs)
+
+	err = store.Put(ctx, "a/b", bytes.NewReader([]byte("replaced")))
+	require.NoError(t, err)
+	require.Equal(t, []byte("replaced"), read(store.Get(ctx, "a/b")))
+
+	err = store.PutIfAbsent(ctx, "m", bytes.NewReader([]byte("first")))
+	require.NoError(t, err)
+
+	err = store.Delete(ctx, "a/b")
+	require.NoError(t, err)
+
+	_, err = store.Get(ctx, "a/b")
+	require.ErrorIs(t, err, objectstore.ErrNotFound)
+
+	err = store.Delete(ctx, "a/b")
+	require.NoError(t, err)
+}
+
+func testPutIfAbsent(t *testing.T, store objectstore.Store) {
+	ctx := context.Background()
+
+	err := store.PutIfAbsent(ctx, "m", bytes.NewReader([]byte("first")))
+	require.NoError(t, err)
+
+	err = store.PutIfAbsent(ctx, "m", bytes.NewReader([]byte("second")))
+	require.ErrorIs(t, err, objectstore.ErrAlreadyExists)
+
+	r, err := store.Get(ctx, "m")
+	require.NoError(t, err)
+	defer r.Close()
+
+	d, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), d)
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, objectstore.NewMemory())
+	testPutIfAbsent(t, objectstore.NewMemory())
+}
+
+func TestFilesystem(t *testing.T) {
+	store, err := objectstore.NewFilesystem(t.TempDir())
+	require.NoError(t, err)
+	testStore(t, store)
+
+	store, err = objectstore.NewFilesystem(t.TempDir())
+	require.NoError(t, err)
+	testPutIfAbsent(t, store)
+}
+
+func TestInstrumented(t *testing.T) {
+	m := objectstore.NewMetrics()
+
+	testStore(t, objectstore.Instrument(objectstore.NewMemory(), m, "memory"))
+	testPutIfAbsent(t, objectstore.Instrument(objectstore.NewMemory(), m, "memory"))
+
+	fs, err := objectstore.NewFilesystem(t.TempDir())
+	require.NoError(t, err)
+
+	_, local := objectstore.Instrument(fs, m, "filesystem").(objectstore.LocalFiles)
+	require.True(t, local)
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(m))
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP linear_objectstore_requests_total Requests to object stores by result: ok, not_found, already_exists or error.
+# TYPE linear_objectstore_requests_total counter
+linear_objectstore_requests_total{operation="delete",result="ok",store="memory"} 2
+linear_objectstore_requests_total{operation="get",result="not_found",store="memory"} 2
+linear_objectstore_requests_total{operation="get",result="ok",store="memory"} 3
+linear_objectstore_requests_total{operation="get_range",result="ok",store="memory"} 1
+linear_objectstore_requests_total{operation="list",result="ok",store="memory"} 3
+linear_objectstore_requests_total{operation="list_dirs",result="ok",store="memory"} 3
+linear_objectstore_requests_total{operation="put",result="ok",store="memory"} 4
+linear_objectstore_requests_total{operation="put_if_absent",result="already_exists",store="memory"} 1
+linear_objectstore_requests_total{operation="put_if_absent",result="ok",store="memory"} 2
+`), "linear_objectstore_requests_total"))
+}
+
+func TestS3(t *testing.T) {
+	e2eutils.WithMinioContainer(t, func(ctx context.Context, s3Client *s3.Client, bucketName string) {
+		testStore(t, objectstore.NewS3(s3Client, bucketName, objectstore.S3Options{}))
+	})
+}
@@ -0,0 +1,243 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type S3Options struct {
+	// Download configures the concurrent ranged download used by Download.
+	Download DownloadOptions
+	// StorageClass of uploaded objects, for example GLACIER_IR. Empty uses the bucket default.
+	StorageClass string
+}
+
+// DownloadOptions zero values fall back to the defaults of the s3 download manager.
+type DownloadOptions struct {
+	PartSize    int64
+	Concurrency int
+	PartRetries int
+}
+
+type S3 struct {
+	client       *s3.Client
+	bucket       string
+	storageClass types.StorageClass
+	uploader     *manager.Uploader
+	downloader   *manager.Downloader
+}
+
+func NewS3(client *s3.Client, bucket string, opts S3Options) *S3 {
+	return &S3{
+		client:       client,
+		bucket:       bucket,
+		storageClass: types.StorageClass(opts.StorageClass),
+		uploader:     manager.NewUploader(client),
+		downloader: manager.NewDownloader(client, func(d *manager.Downloader) {
+			if opts.Download.PartSize > 0 {
+				d.PartSize = opts.Download.PartSize
+			}
+			if opts.Download.Concurrency > 0 {
+				d.Concurrency = opts.Download.Concurrency
+			}
+			if opts.Download.PartRetries > 0 {
+				d.PartBodyMaxRetries = opts.Download.PartRetries
+			}
+		}),
+	}
+}
+
+func isStatus(err error, statusCodes ...int) bool {
+	var re *smithyhttp.ResponseError
+	if !errors.As(err, &re) {
+		return false
+	}
+	for _, sc := range statusCodes {
+		if re.HTTPStatusCode() == sc {
+			return true
+		}
+	}
+	return false
+}
+
+func isNotFound(err error) bool {
+	var nsk *types.NoSuchKey
+	return errors.As(err, &nsk) || isStatus(err, http.StatusNotFound)
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	infos := []ObjectInfo{}
+	var continuationToken *string
+
+	for {
+		res, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+
+		for _, o := range res.Contents {
+			info := ObjectInfo{
+				Key:  aws.ToString(o.Key),
+				Size: uint64(aws.ToInt64(o.Size)),
+			}
+			if o.LastModified != nil {
+				info.LastModified = *o.LastModified
+			}
+			infos = append(infos, info)
+		}
+
+		continuationToken = res.NextContinuationToken
+
+		if continuationToken == nil {
+			break
+		}
+	}
+
+	return infos, nil
+}
+
+func (s *S3) ListDirs(ctx context.Context, prefix string) ([]string, error) {
+	dirs := []string{}
+	var continuationToken *string
+
+	for {
+		res, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.bucket),
+			Prefix:            aws.String(prefix),
+			Delimiter:         aws.String("/"),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dirs of %s: %w", prefix, err)
+		}
+
+		for _, p := range res.CommonPrefixes {
+			dir := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(p.Prefix), prefix), "/")
+			dirs = append(dirs, dir)
+		}
+
+		continuationToken = res.NextContinuationToken
+
+		if continuationToken == nil {
+			break
+		}
+	}
+
+	return dirs, nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	return res.Body, nil
+}
+
+func (s *S3) GetRange(ctx context.Context, key string, offset, length uint64) (io.ReadCloser, error) {
+	res, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get range of %s: %w", key, err)
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		Body:         r,
+		StorageClass: s.storageClass,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// PutIfAbsent reads the object into memory, it is meant for small objects such as manifests.
+func (s *S3) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object data: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		Body:         bytes.NewReader(d),
+		IfNoneMatch:  aws.String("*"),
+		StorageClass: s.storageClass,
+	})
+	if isStatus(err, http.StatusPreconditionFailed, http.StatusConflict) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Download(ctx context.Context, key string, w io.WriterAt) error {
+	_, err := s.downloader.Download(ctx, w, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return nil
+}
+
+// Ping checks that the bucket exists and can be accessed.
+func (s *S3) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access bucket %s: %w", s.bucket, err)
+	}
+	return nil
+}